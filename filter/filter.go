@@ -77,21 +77,63 @@ func compileFilterNoGlob(filters []string) Filter {
 	return &out
 }
 
+// CompileFold is Compile with case insensitive matching, ie, "CPU*" matches
+// "cpu0".
+func CompileFold(filters []string) (Filter, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	lower := make([]string, len(filters))
+	for i, filter := range filters {
+		lower[i] = strings.ToLower(filter)
+	}
+	f, err := Compile(lower)
+	if err != nil {
+		return nil, err
+	}
+	return &foldFilter{f: f}, nil
+}
+
+type foldFilter struct {
+	f Filter
+}
+
+func (f *foldFilter) Match(s string) bool {
+	return f.f.Match(strings.ToLower(s))
+}
+
 type IncludeExcludeFilter struct {
 	include Filter
 	exclude Filter
 }
 
+// NewIncludeExcludeFilter returns a Filter matching the strings matched by
+// include, or every string when include is empty, which are not matched by
+// exclude: exclude takes precedence over include.
 func NewIncludeExcludeFilter(
 	include []string,
 	exclude []string,
 ) (Filter, error) {
-	in, err := Compile(include)
+	return newIncludeExcludeFilter(include, exclude, Compile)
+}
+
+// NewIncludeExcludeFilterFold is NewIncludeExcludeFilter with case
+// insensitive matching.
+func NewIncludeExcludeFilterFold(
+	include []string,
+	exclude []string,
+) (Filter, error) {
+	return newIncludeExcludeFilter(include, exclude, CompileFold)
+}
+
+func newIncludeExcludeFilter(include, exclude []string, compile func([]string) (Filter, error)) (Filter, error) {
+	in, err := compile(include)
 	if err != nil {
 		return nil, err
 	}
 
-	ex, err := Compile(exclude)
+	ex, err := compile(exclude)
 	if err != nil {
 		return nil, err
 	}
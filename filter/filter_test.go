@@ -55,6 +55,88 @@ func TestIncludeExclude(t *testing.T) {
 	assert.Equal(t, []string{"best", "timeseries", "ever"}, tags)
 }
 
+func TestIncludeExcludePrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		expected []string
+	}{
+		{
+			name:     "include only",
+			include:  []string{"kills_*", "deaths"},
+			expected: []string{"kills_zombie", "kills_creeper", "deaths"},
+		},
+		{
+			name:     "exclude only",
+			exclude:  []string{"kills_*"},
+			expected: []string{"jumps", "deaths"},
+		},
+		{
+			name:     "exclude wins",
+			include:  []string{"kills_*", "jumps"},
+			exclude:  []string{"*_creeper"},
+			expected: []string{"jumps", "kills_zombie"},
+		},
+		{
+			name:     "single character wildcard",
+			include:  []string{"death?"},
+			expected: []string{"deaths"},
+		},
+		{
+			name:     "neither",
+			expected: []string{"jumps", "kills_zombie", "kills_creeper", "deaths"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewIncludeExcludeFilter(tt.include, tt.exclude)
+			assert.NoError(t, err)
+
+			var matched []string
+			for _, s := range []string{"jumps", "kills_zombie", "kills_creeper", "deaths"} {
+				if f.Match(s) {
+					matched = append(matched, s)
+				}
+			}
+			assert.ElementsMatch(t, tt.expected, matched)
+		})
+	}
+}
+
+func TestCompileFold(t *testing.T) {
+	f, err := CompileFold(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, f)
+
+	f, err = CompileFold([]string{"CPU"})
+	assert.NoError(t, err)
+	assert.True(t, f.Match("cpu"))
+	assert.True(t, f.Match("Cpu"))
+	assert.False(t, f.Match("cpu0"))
+
+	f, err = CompileFold([]string{"Net*", "mem?"})
+	assert.NoError(t, err)
+	assert.True(t, f.Match("NETWORK"))
+	assert.True(t, f.Match("Mem0"))
+	assert.False(t, f.Match("memory"))
+}
+
+func TestIncludeExcludeFold(t *testing.T) {
+	f, err := NewIncludeExcludeFilterFold([]string{"Users*"}, []string{"*_ARCHIVE"})
+	assert.NoError(t, err)
+	assert.True(t, f.Match("users"))
+	assert.True(t, f.Match("USERS_2021"))
+	assert.False(t, f.Match("users_archive"))
+	assert.False(t, f.Match("orders"))
+
+	// the default filter stays case sensitive
+	f, err = NewIncludeExcludeFilter([]string{"Users*"}, nil)
+	assert.NoError(t, err)
+	assert.False(t, f.Match("users"))
+}
+
 var benchbool bool
 
 func BenchmarkFilterSingleNoGlobFalse(b *testing.B) {
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// BackoffConfig configures the waits between the attempts of RetryBackoff.
+type BackoffConfig struct {
+	// InitialInterval is the wait after the first failed attempt, zero
+	// defaults to 100ms.
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between attempts, zero means no cap.
+	MaxInterval time.Duration
+	// Multiplier grows the wait after each failed attempt, values below 1
+	// default to 2.
+	Multiplier float64
+	// MaxElapsed is the time after which no further attempt is made, zero
+	// means retrying until the context is done.
+	MaxElapsed time.Duration
+}
+
+// RetryBackoff calls fn until it succeeds, waiting between attempts with an
+// exponentially growing interval. Half of each wait is randomized so that
+// clients failing together do not retry together. The last error of fn is
+// returned once MaxElapsed would be exceeded, or along with the context
+// error when the context is done first.
+func RetryBackoff(ctx context.Context, cfg BackoffConfig, fn func() error) error {
+	multiplier := cfg.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	start := time.Now()
+	interval := cfg.InitialInterval
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		if cfg.MaxInterval > 0 && interval > cfg.MaxInterval {
+			interval = cfg.MaxInterval
+		}
+		wait := interval/2 + RandomDuration(interval-interval/2)
+
+		if cfg.MaxElapsed > 0 && time.Since(start)+wait > cfg.MaxElapsed {
+			return err
+		}
+		if serr := SleepContext(ctx, wait); serr != nil {
+			return fmt.Errorf("%w (last error: %s)", serr, err)
+		}
+
+		interval = time.Duration(float64(interval) * multiplier)
+	}
+}
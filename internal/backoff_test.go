@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryBackoffSuccessOnSecondTry(t *testing.T) {
+	attempts := 0
+	err := RetryBackoff(context.Background(), BackoffConfig{
+		InitialInterval: time.Millisecond,
+		MaxElapsed:      time.Second,
+	}, func() error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, attempts)
+}
+
+func TestRetryBackoffCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	err := RetryBackoff(ctx, BackoffConfig{
+		InitialInterval: time.Hour,
+	}, func() error {
+		attempts++
+		return errors.New("connection refused")
+	})
+	require.True(t, errors.Is(err, context.Canceled))
+	require.Contains(t, err.Error(), "connection refused")
+	require.Equal(t, 1, attempts)
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestRetryBackoffExhausted(t *testing.T) {
+	attempts := 0
+	lastErr := errors.New("still down")
+	err := RetryBackoff(context.Background(), BackoffConfig{
+		InitialInterval: 2 * time.Millisecond,
+		MaxInterval:     10 * time.Millisecond,
+		Multiplier:      2,
+		MaxElapsed:      50 * time.Millisecond,
+	}, func() error {
+		attempts++
+		return lastErr
+	})
+	require.Equal(t, lastErr, err)
+	require.Greater(t, attempts, 2)
+}
+
+func TestRetryBackoffIntervalGrowth(t *testing.T) {
+	var calls []time.Time
+	err := RetryBackoff(context.Background(), BackoffConfig{
+		InitialInterval: 10 * time.Millisecond,
+		MaxInterval:     20 * time.Millisecond,
+		Multiplier:      4,
+	}, func() error {
+		calls = append(calls, time.Now())
+		if len(calls) < 4 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, calls, 4)
+	// waits are at least half of the interval, which is capped
+	require.GreaterOrEqual(t, int64(calls[1].Sub(calls[0])), int64(5*time.Millisecond))
+	require.GreaterOrEqual(t, int64(calls[2].Sub(calls[1])), int64(10*time.Millisecond))
+	require.GreaterOrEqual(t, int64(calls[3].Sub(calls[2])), int64(10*time.Millisecond))
+}
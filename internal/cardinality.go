@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+)
+
+// CardinalityLimiter bounds the number of distinct tag sets emitted for each
+// measurement within a window. Once the limit is reached, metrics with new tag
+// sets are rejected until the window rolls over; tag sets already seen during
+// the window continue to be allowed.
+type CardinalityLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	log     cua.Logger
+	now     func() time.Time
+	start   time.Time
+	seen    map[string]map[string]struct{}
+	dropped map[string]int
+	// reported is the part of dropped already logged
+	reported map[string]int
+}
+
+// NewCardinalityLimiter returns a limiter allowing at most limit distinct tag
+// sets per measurement within each window. The number of dropped metrics per
+// measurement is logged to log as each window closes and by Flush. A limit
+// <= 0 disables limiting.
+func NewCardinalityLimiter(limit int, window time.Duration, log cua.Logger) *CardinalityLimiter {
+	c := &CardinalityLimiter{
+		limit:  limit,
+		window: window,
+		log:    log,
+		now:    time.Now,
+	}
+	c.reset(c.now())
+	return c
+}
+
+// Allow reports whether a metric with the given measurement and tags may be
+// emitted.
+func (c *CardinalityLimiter) Allow(measurement string, tags map[string]string) bool {
+	if c.limit <= 0 {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now := c.now(); c.window > 0 && now.Sub(c.start) >= c.window {
+		c.flush()
+		c.reset(now)
+	}
+
+	key := tagSetKey(tags)
+	sets, ok := c.seen[measurement]
+	if !ok {
+		sets = make(map[string]struct{})
+		c.seen[measurement] = sets
+	}
+	if _, ok := sets[key]; ok {
+		return true
+	}
+	if len(sets) >= c.limit {
+		c.dropped[measurement]++
+		return false
+	}
+	sets[key] = struct{}{}
+	return true
+}
+
+// Dropped returns the number of metrics dropped for measurement in the
+// current window.
+func (c *CardinalityLimiter) Dropped(measurement string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dropped[measurement]
+}
+
+// Flush logs the metrics dropped since they were last logged, closing the
+// window when it is over. Plugins call it at the end of each gather so drops
+// are reported without waiting for a metric to close the window, or when the
+// window never closes.
+func (c *CardinalityLimiter) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.flush()
+	if now := c.now(); c.window > 0 && now.Sub(c.start) >= c.window {
+		c.reset(now)
+	}
+}
+
+func (c *CardinalityLimiter) flush() {
+	for measurement, n := range c.dropped {
+		if n <= c.reported[measurement] {
+			continue
+		}
+		if c.log != nil {
+			c.log.Warnf("Dropped %d metrics for %q exceeding the limit of %d tag sets", n-c.reported[measurement], measurement, c.limit)
+		}
+		c.reported[measurement] = n
+	}
+}
+
+func (c *CardinalityLimiter) reset(now time.Time) {
+	c.start = now
+	c.seen = make(map[string]map[string]struct{})
+	c.dropped = make(map[string]int)
+	c.reported = make(map[string]int)
+}
+
+// tagSetKey returns a string uniquely identifying a set of tags regardless
+// of map ordering.
+func tagSetKey(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(tags[k])
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
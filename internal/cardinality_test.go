@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCardinalityLimiterExceedsLimit(t *testing.T) {
+	c := NewCardinalityLimiter(3, time.Minute, testutil.Logger{})
+
+	for i := 0; i < 3; i++ {
+		require.True(t, c.Allow("postgresql", map[string]string{"db": strconv.Itoa(i)}))
+	}
+	require.False(t, c.Allow("postgresql", map[string]string{"db": "3"}))
+	require.False(t, c.Allow("postgresql", map[string]string{"db": "4"}))
+	require.Equal(t, 2, c.Dropped("postgresql"))
+
+	// tag sets already seen are still allowed
+	require.True(t, c.Allow("postgresql", map[string]string{"db": "0"}))
+
+	// measurements are tracked independently
+	require.True(t, c.Allow("other", map[string]string{"db": "3"}))
+}
+
+func TestCardinalityLimiterWindow(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	now := time.Unix(0, 0)
+	c := NewCardinalityLimiter(1, time.Minute, testutil.Logger{})
+	c.now = func() time.Time { return now }
+	c.reset(now)
+
+	require.True(t, c.Allow("m", map[string]string{"a": "1"}))
+	require.False(t, c.Allow("m", map[string]string{"a": "2"}))
+
+	now = now.Add(time.Minute)
+	require.True(t, c.Allow("m", map[string]string{"a": "2"}))
+	require.Equal(t, 0, c.Dropped("m"))
+	require.Contains(t, buf.String(), `Dropped 1 metrics for "m"`)
+}
+
+func TestCardinalityLimiterFlushZeroWindow(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	c := NewCardinalityLimiter(1, 0, testutil.Logger{})
+	require.True(t, c.Allow("m", map[string]string{"a": "1"}))
+	require.False(t, c.Allow("m", map[string]string{"a": "2"}))
+	require.False(t, c.Allow("m", map[string]string{"a": "3"}))
+
+	c.Flush()
+	require.Contains(t, buf.String(), `Dropped 2 metrics for "m"`)
+
+	// only the drops since the last flush are logged, the window never ends
+	buf.Reset()
+	c.Flush()
+	require.Empty(t, buf.String())
+	require.False(t, c.Allow("m", map[string]string{"a": "4"}))
+	c.Flush()
+	require.Contains(t, buf.String(), `Dropped 1 metrics for "m"`)
+	require.Equal(t, 3, c.Dropped("m"))
+}
+
+func TestCardinalityLimiterFlushWindowOver(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	now := time.Unix(0, 0)
+	c := NewCardinalityLimiter(1, time.Minute, testutil.Logger{})
+	c.now = func() time.Time { return now }
+	c.reset(now)
+
+	require.True(t, c.Allow("m", map[string]string{"a": "1"}))
+	require.False(t, c.Allow("m", map[string]string{"a": "2"}))
+
+	// no metric arrives after the window, the flush still reports the drops
+	now = now.Add(time.Minute)
+	c.Flush()
+	require.Contains(t, buf.String(), `Dropped 1 metrics for "m"`)
+	require.Equal(t, 0, c.Dropped("m"))
+	require.True(t, c.Allow("m", map[string]string{"a": "2"}))
+}
+
+func TestCardinalityLimiterTagOrder(t *testing.T) {
+	c := NewCardinalityLimiter(1, time.Minute, nil)
+
+	a := map[string]string{}
+	a["x"] = "1"
+	a["y"] = "2"
+	b := map[string]string{}
+	b["y"] = "2"
+	b["x"] = "1"
+
+	require.True(t, c.Allow("m", a))
+	require.True(t, c.Allow("m", b))
+}
+
+func TestCardinalityLimiterDisabled(t *testing.T) {
+	c := NewCardinalityLimiter(0, time.Minute, nil)
+	for i := 0; i < 100; i++ {
+		require.True(t, c.Allow("m", map[string]string{"i": strconv.Itoa(i)}))
+	}
+}
@@ -72,6 +72,62 @@ func (r *GzipReader) Read(b []byte) (int, error) {
 
 }
 
+// gzipMagic is the header identifying a gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// DecompressGzip returns a ReadCloser of the decompressed gzip stream read
+// from data. Closing it closes the gzip reader and data itself when data is an
+// io.Closer. An error is returned if data is not a gzip stream.
+func DecompressGzip(data io.Reader) (io.ReadCloser, error) {
+	z, err := gzip.NewReader(data)
+	if err != nil {
+		if errors.Is(err, gzip.ErrHeader) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("data is not gzip compressed: %w", err)
+		}
+		return nil, fmt.Errorf("gzip new reader: %w", err)
+	}
+	rc := &gzipReadCloser{z: z}
+	if c, ok := data.(io.Closer); ok {
+		rc.c = c
+	}
+	return rc, nil
+}
+
+type gzipReadCloser struct {
+	z *gzip.Reader
+	c io.Closer
+}
+
+func (r *gzipReadCloser) Read(b []byte) (int, error) {
+	return r.z.Read(b) //nolint:wrapcheck
+}
+
+func (r *gzipReadCloser) Close() error {
+	err := r.z.Close()
+	if r.c != nil {
+		if cerr := r.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+	return nil
+}
+
+// IsGzipped reports whether the stream read from r starts with the gzip magic
+// bytes. The returned reader replays the bytes consumed while peeking and must
+// be used in place of r.
+func IsGzipped(r io.Reader) (bool, io.Reader, error) {
+	buf := make([]byte, len(gzipMagic))
+	n, err := io.ReadFull(r, buf)
+	replay := io.MultiReader(bytes.NewReader(buf[:n]), r)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, replay, fmt.Errorf("read: %w", err)
+	}
+	return bytes.Equal(buf[:n], gzipMagic), replay, nil
+}
+
 // NewContentEncoder returns a ContentEncoder for the encoding type.
 func NewContentEncoder(encoding string) (ContentEncoder, error) {
 	switch encoding {
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"bytes"
+	"compress/gzip"
 	"io"
 	"testing"
 
@@ -92,3 +93,70 @@ func TestStreamGzipDecode(t *testing.T) {
 
 	require.Equal(t, []byte("howdy"), b[:n])
 }
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func gzipBytes(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestDecompressGzip(t *testing.T) {
+	src := &closeRecorder{Reader: bytes.NewReader(gzipBytes(t, "howdy"))}
+
+	rc, err := DecompressGzip(src)
+	require.NoError(t, err)
+
+	actual, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.Equal(t, "howdy", string(actual))
+
+	require.NoError(t, rc.Close())
+	require.True(t, src.closed)
+}
+
+func TestDecompressGzipNotGzip(t *testing.T) {
+	_, err := DecompressGzip(bytes.NewReader([]byte("plain text, not gzip")))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not gzip compressed")
+
+	_, err = DecompressGzip(bytes.NewReader(nil))
+	require.Error(t, err)
+}
+
+func TestIsGzipped(t *testing.T) {
+	compressed := gzipBytes(t, "howdy")
+
+	ok, r, err := IsGzipped(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	require.True(t, ok)
+	replayed, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, compressed, replayed)
+
+	ok, r, err = IsGzipped(bytes.NewReader([]byte("howdy")))
+	require.NoError(t, err)
+	require.False(t, ok)
+	replayed, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "howdy", string(replayed))
+
+	ok, r, err = IsGzipped(bytes.NewReader([]byte{0x1f}))
+	require.NoError(t, err)
+	require.False(t, ok)
+	replayed, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x1f}, replayed)
+}
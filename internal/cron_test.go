@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronNext(t *testing.T) {
+	rfc3339 := func(value string) time.Time {
+		tm, err := time.Parse(time.RFC3339, value)
+		require.NoError(t, err)
+		return tm
+	}
+
+	tests := []struct {
+		expr     string
+		now      string
+		expected string
+	}{
+		{"*/5 * * * *", "2023-01-02T03:04:05Z", "2023-01-02T03:05:00Z"},
+		{"*/5 * * * *", "2023-01-02T03:05:00Z", "2023-01-02T03:10:00Z"},
+		{"*/5 * * * *", "2023-01-02T23:58:00Z", "2023-01-03T00:00:00Z"},
+		{"0 0 * * *", "2023-01-02T03:04:05Z", "2023-01-03T00:00:00Z"},
+		{"0 0 * * *", "2023-12-31T12:00:00Z", "2024-01-01T00:00:00Z"},
+		{"30 9 * * 1-5", "2023-01-06T10:00:00Z", "2023-01-09T09:30:00Z"},
+		{"0 12 1 * *", "2023-01-02T00:00:00Z", "2023-02-01T12:00:00Z"},
+		{"15,45 * * * *", "2023-01-02T03:20:00Z", "2023-01-02T03:45:00Z"},
+		{"0 0 * * 7", "2023-01-02T00:00:00Z", "2023-01-08T00:00:00Z"},
+		{"0 0 29 2 *", "2023-01-01T00:00:00Z", "2024-02-29T00:00:00Z"},
+		// day of month or day of week when both are restricted
+		{"0 0 15 * 0", "2023-01-02T00:00:00Z", "2023-01-08T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		s, err := ParseCron(tt.expr)
+		require.NoError(t, err, tt.expr)
+		require.Equal(t, rfc3339(tt.expected), s.Next(rfc3339(tt.now)), "%s from %s", tt.expr, tt.now)
+	}
+}
+
+func TestParseCronNextLocation(t *testing.T) {
+	loc := time.FixedZone("IST", 5*3600+1800)
+	s, err := ParseCron("0 * * * *")
+	require.NoError(t, err)
+	require.Equal(t,
+		time.Date(2023, 1, 2, 4, 0, 0, 0, loc),
+		s.Next(time.Date(2023, 1, 2, 3, 10, 0, 0, loc)))
+}
+
+func TestParseCronNever(t *testing.T) {
+	s, err := ParseCron("0 0 30 2 *")
+	require.NoError(t, err)
+	require.True(t, s.Next(time.Now()).IsZero())
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+	} {
+		_, err := ParseCron(expr)
+		require.Error(t, err, expr)
+	}
+}
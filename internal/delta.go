@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"sync"
+)
+
+// DeltaStore converts cumulative counters into per-interval deltas. The
+// previous value of each counter is kept under a caller provided key, see
+// DeltaKey for the key of a (measurement, tag set, field) counter.
+type DeltaStore struct {
+	mu   sync.Mutex
+	last map[string]float64
+}
+
+// NewDeltaStore returns an empty DeltaStore.
+func NewDeltaStore() *DeltaStore {
+	return &DeltaStore{
+		last: make(map[string]float64),
+	}
+}
+
+// Delta records value as the latest sample of the counter key and returns
+// the difference with the previous sample. The returned flag is false, and
+// the delta should not be emitted, on the first sample of a counter and when
+// the counter went backwards (ie, it was reset).
+func (d *DeltaStore) Delta(key string, value float64) (float64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	prev, ok := d.last[key]
+	d.last[key] = value
+	if !ok || value < prev {
+		return 0, false
+	}
+	return value - prev, true
+}
+
+// DeltaKey returns the DeltaStore key of the field of a measurement with the
+// given tags. The key does not depend on the order of the tags.
+func DeltaKey(measurement string, tags map[string]string, field string) string {
+	return measurement + "\x00" + tagSetKey(tags) + "\x00" + field
+}
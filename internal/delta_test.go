@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaStoreFirstSample(t *testing.T) {
+	d := NewDeltaStore()
+	delta, ok := d.Delta("reads", 100)
+	require.False(t, ok)
+	require.Equal(t, 0.0, delta)
+}
+
+func TestDeltaStoreDelta(t *testing.T) {
+	d := NewDeltaStore()
+	d.Delta("reads", 100)
+
+	delta, ok := d.Delta("reads", 150)
+	require.True(t, ok)
+	require.Equal(t, 50.0, delta)
+
+	delta, ok = d.Delta("reads", 150)
+	require.True(t, ok)
+	require.Equal(t, 0.0, delta)
+
+	// counters are tracked independently
+	_, ok = d.Delta("writes", 10)
+	require.False(t, ok)
+}
+
+func TestDeltaStoreReset(t *testing.T) {
+	d := NewDeltaStore()
+	d.Delta("reads", 100)
+
+	delta, ok := d.Delta("reads", 20)
+	require.False(t, ok)
+	require.Equal(t, 0.0, delta)
+
+	// the reset value becomes the new baseline
+	delta, ok = d.Delta("reads", 35)
+	require.True(t, ok)
+	require.Equal(t, 15.0, delta)
+}
+
+func TestDeltaKey(t *testing.T) {
+	a := DeltaKey("rethinkdb_engine", map[string]string{"type": "cluster", "host": "a"}, "total_reads")
+	b := DeltaKey("rethinkdb_engine", map[string]string{"host": "a", "type": "cluster"}, "total_reads")
+	require.Equal(t, a, b)
+
+	require.NotEqual(t, a, DeltaKey("rethinkdb_engine", map[string]string{"type": "cluster", "host": "b"}, "total_reads"))
+	require.NotEqual(t, a, DeltaKey("rethinkdb_engine", map[string]string{"type": "cluster", "host": "a"}, "total_writes"))
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+)
+
+// DrainMetrics adds the metrics remaining on ch to acc until ch is closed
+// or the timeout elapses, whichever comes first. A timeout of zero or less
+// only flushes the metrics already buffered on ch. The number of metrics
+// added is returned.
+//
+// The channel is owned by the producer, which is expected to close it once
+// it stops sending so the drain can complete before the timeout.
+func DrainMetrics(ch <-chan cua.Metric, acc cua.Accumulator, timeout time.Duration) int {
+	n := 0
+
+	if timeout <= 0 {
+		for {
+			select {
+			case m, ok := <-ch:
+				if !ok {
+					return n
+				}
+				acc.AddMetric(m)
+				n++
+			default:
+				return n
+			}
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case m, ok := <-ch:
+			if !ok {
+				return n
+			}
+			acc.AddMetric(m)
+			n++
+		case <-timer.C:
+			return n
+		}
+	}
+}
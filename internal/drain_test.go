@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainMetrics(t *testing.T) {
+	ch := make(chan cua.Metric, 10)
+	for i := 0; i < 5; i++ {
+		ch <- testutil.TestMetric(i)
+	}
+	close(ch)
+
+	var acc testutil.Accumulator
+	n := DrainMetrics(ch, &acc, time.Second)
+	require.Equal(t, 5, n)
+	require.Equal(t, uint64(5), acc.NMetrics())
+}
+
+func TestDrainMetricsProducer(t *testing.T) {
+	ch := make(chan cua.Metric)
+	go func() {
+		for i := 0; i < 3; i++ {
+			ch <- testutil.TestMetric(i)
+		}
+		close(ch)
+	}()
+
+	var acc testutil.Accumulator
+	require.Equal(t, 3, DrainMetrics(ch, &acc, 5*time.Second))
+	require.Equal(t, uint64(3), acc.NMetrics())
+}
+
+func TestDrainMetricsTimeout(t *testing.T) {
+	ch := make(chan cua.Metric, 10)
+	ch <- testutil.TestMetric(1)
+	ch <- testutil.TestMetric(2)
+
+	var acc testutil.Accumulator
+	start := time.Now()
+	n := DrainMetrics(ch, &acc, 50*time.Millisecond)
+	require.Equal(t, 2, n)
+	require.Equal(t, uint64(2), acc.NMetrics())
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+}
+
+func TestDrainMetricsNoTimeout(t *testing.T) {
+	ch := make(chan cua.Metric, 10)
+	ch <- testutil.TestMetric(1)
+
+	var acc testutil.Accumulator
+	require.Equal(t, 1, DrainMetrics(ch, &acc, 0))
+	require.Equal(t, uint64(1), acc.NMetrics())
+}
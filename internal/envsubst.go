@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"os"
+	"strings"
+)
+
+// EnvSubst expands the ${VAR} and $VAR references to environment variables
+// in s, "$$" is an escaped "$". Variable names start with a letter or an
+// underscore, so positional parameters like $1 are left as is. Unset
+// variables expand to the empty string.
+func EnvSubst(s string) string {
+	return envSubst(s, false)
+}
+
+// EnvSubstKeepUnset is EnvSubst leaving the references to unset variables
+// as they are.
+func EnvSubstKeepUnset(s string) string {
+	return envSubst(s, true)
+}
+
+func envSubst(s string, keepUnset bool) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		ref, name := "", ""
+		switch next := s[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+			continue
+		case next == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 || !isEnvName(s[i+2:i+2+end]) {
+				b.WriteByte('$')
+				continue
+			}
+			name = s[i+2 : i+2+end]
+			ref = s[i : i+3+end]
+		case isEnvNameStart(next):
+			end := i + 2
+			for end < len(s) && isEnvNameChar(s[end]) {
+				end++
+			}
+			name = s[i+1 : end]
+			ref = s[i:end]
+		default:
+			b.WriteByte('$')
+			continue
+		}
+
+		if v, ok := os.LookupEnv(name); ok {
+			b.WriteString(v)
+		} else if keepUnset {
+			b.WriteString(ref)
+		}
+		i += len(ref) - 1
+	}
+	return b.String()
+}
+
+func isEnvName(s string) bool {
+	if s == "" || !isEnvNameStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isEnvNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isEnvNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isEnvNameChar(c byte) bool {
+	return isEnvNameStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvSubst(t *testing.T) {
+	require.NoError(t, os.Setenv("CUA_TEST_SCHEMA", "metrics"))
+	require.NoError(t, os.Setenv("CUA_TEST_EMPTY", ""))
+	require.NoError(t, os.Unsetenv("CUA_TEST_UNSET"))
+	defer os.Unsetenv("CUA_TEST_SCHEMA")
+	defer os.Unsetenv("CUA_TEST_EMPTY")
+
+	tests := []struct {
+		input     string
+		expected  string
+		keepUnset string
+	}{
+		{"SELECT 1", "SELECT 1", "SELECT 1"},
+		{"FROM ${CUA_TEST_SCHEMA}.t", "FROM metrics.t", "FROM metrics.t"},
+		{"FROM $CUA_TEST_SCHEMA.t", "FROM metrics.t", "FROM metrics.t"},
+		{"${CUA_TEST_SCHEMA}${CUA_TEST_SCHEMA}", "metricsmetrics", "metricsmetrics"},
+		{"a${CUA_TEST_EMPTY}b", "ab", "ab"},
+		{"FROM ${CUA_TEST_UNSET}.t", "FROM .t", "FROM ${CUA_TEST_UNSET}.t"},
+		{"FROM $CUA_TEST_UNSET.t", "FROM .t", "FROM $CUA_TEST_UNSET.t"},
+		{"cost $$5", "cost $5", "cost $5"},
+		{"$$CUA_TEST_SCHEMA", "$CUA_TEST_SCHEMA", "$CUA_TEST_SCHEMA"},
+		{"$$$CUA_TEST_SCHEMA", "$metrics", "$metrics"},
+		{"WHERE datname = $1", "WHERE datname = $1", "WHERE datname = $1"},
+		{"trailing $", "trailing $", "trailing $"},
+		{"${unterminated", "${unterminated", "${unterminated"},
+		{"${1invalid}", "${1invalid}", "${1invalid}"},
+		{"${}", "${}", "${}"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, EnvSubst(tt.input), tt.input)
+		require.Equal(t, tt.keepUnset, EnvSubstKeepUnset(tt.input), tt.input)
+	}
+}
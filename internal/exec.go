@@ -36,10 +36,61 @@ func StdOutputTimeout(c *exec.Cmd, timeout time.Duration) ([]byte, error) {
 }
 
 // RunTimeout runs the given command with the given timeout.
-// If the command times out, it attempts to kill the process.
+// If the command times out, it attempts to kill the process and returns
+// ErrTimeout. On unix the command runs in its own process group which is
+// killed as a whole, so children of the command don't outlive it, unless
+// the caller set the process attributes of the command.
+// Otherwise the error of the command is returned, see ExitStatus.
 func RunTimeout(c *exec.Cmd, timeout time.Duration) error {
+	setProcessGroup(c)
 	if err := c.Start(); err != nil {
 		return fmt.Errorf("runtimeout start: %w", err)
 	}
 	return WaitTimeout(c, timeout)
 }
+
+// DefaultMaxCommandOutput is the number of bytes of each output stream kept
+// by RunTimeoutOutput.
+const DefaultMaxCommandOutput = 4 * 1024 * 1024
+
+// RunTimeoutOutput runs the given command with the given timeout like
+// RunTimeout and returns its stdout and stderr separately. At most
+// DefaultMaxCommandOutput bytes of each stream are kept. The output written
+// before the command timed out is returned along with ErrTimeout.
+func RunTimeoutOutput(c *exec.Cmd, timeout time.Duration) ([]byte, []byte, error) {
+	return RunTimeoutOutputLimit(c, timeout, DefaultMaxCommandOutput)
+}
+
+// RunTimeoutOutputLimit is RunTimeoutOutput keeping at most limit bytes of
+// each output stream, the remaining output is discarded.
+func RunTimeoutOutputLimit(c *exec.Cmd, timeout time.Duration, limit int) ([]byte, []byte, error) {
+	stdout := &limitedBuffer{limit: limit}
+	stderr := &limitedBuffer{limit: limit}
+	c.Stdout = stdout
+	c.Stderr = stderr
+
+	err := RunTimeout(c, timeout)
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the
+// rest without failing the writes, so the writer isn't interrupted.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
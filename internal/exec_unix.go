@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"os/exec"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -19,16 +20,34 @@ const KillGrace = 5 * time.Second
 // It assumes the command has already been started.
 // If the command times out, it attempts to kill the process.
 func WaitTimeout(c *exec.Cmd, timeout time.Duration) error {
-	var kill *time.Timer
+	// the timers run concurrently with Wait, mu guards their state so no
+	// signal is sent once the command has been waited for
+	var (
+		mu       sync.Mutex
+		done     bool
+		termSent bool
+		kill     *time.Timer
+	)
 	term := time.AfterFunc(timeout, func() {
-		err := c.Process.Signal(syscall.SIGTERM)
+		mu.Lock()
+		defer mu.Unlock()
+		if done {
+			return
+		}
+		termSent = true
+		err := signalProcess(c, syscall.SIGTERM)
 		if err != nil {
 			log.Printf("E! [agent] Error terminating process: %s", err)
 			return
 		}
 
 		kill = time.AfterFunc(KillGrace, func() {
-			err := c.Process.Kill()
+			mu.Lock()
+			defer mu.Unlock()
+			if done {
+				return
+			}
+			err := signalProcess(c, syscall.SIGKILL)
 			if err != nil {
 				log.Printf("E! [agent] Error killing process: %s", err)
 				return
@@ -39,10 +58,14 @@ func WaitTimeout(c *exec.Cmd, timeout time.Duration) error {
 	err := c.Wait()
 
 	// Shutdown all timers
+	mu.Lock()
+	done = true
+	term.Stop()
 	if kill != nil {
 		kill.Stop()
 	}
-	termSent := !term.Stop()
+	timedOut := termSent
+	mu.Unlock()
 
 	// If the process exited without error treat it as success.  This allows a
 	// process to do a clean shutdown on signal.
@@ -51,7 +74,7 @@ func WaitTimeout(c *exec.Cmd, timeout time.Duration) error {
 	}
 
 	// If SIGTERM was sent then treat any process error as a timeout.
-	if termSent {
+	if timedOut {
 		return ErrTimeout
 	}
 
@@ -62,3 +85,28 @@ func WaitTimeout(c *exec.Cmd, timeout time.Duration) error {
 
 	return nil
 }
+
+// setProcessGroup runs the command in its own process group so the command
+// and its children can be signalled together. Process attributes set by the
+// caller are left as they are.
+func setProcessGroup(c *exec.Cmd) {
+	if c.SysProcAttr != nil {
+		return
+	}
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcess sends sig to the process of the command, or to its whole
+// process group when the command leads one.
+func signalProcess(c *exec.Cmd, sig syscall.Signal) error {
+	if c.SysProcAttr != nil && c.SysProcAttr.Setpgid && c.SysProcAttr.Pgid == 0 {
+		if err := syscall.Kill(-c.Process.Pid, sig); err != nil {
+			return fmt.Errorf("kill process group: %w", err)
+		}
+		return nil
+	}
+	if err := c.Process.Signal(sig); err != nil {
+		return fmt.Errorf("signal: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+//go:build !windows
+// +build !windows
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetExitInfoCode(t *testing.T) {
+	if shell == "" {
+		t.Skip("'sh' binary not available on OS, skipping.")
+	}
+	err := exec.Command(shell, "-c", "exit 137").Run()
+
+	info, ok := GetExitInfo(err)
+	require.True(t, ok)
+	require.Equal(t, ExitInfo{Code: 137}, info)
+
+	code, ok := ExitStatus(err)
+	require.True(t, ok)
+	require.Equal(t, 137, code)
+
+	_, ok = SignalStatus(err)
+	require.False(t, ok)
+}
+
+func TestGetExitInfoSignal(t *testing.T) {
+	if shell == "" {
+		t.Skip("'sh' binary not available on OS, skipping.")
+	}
+	err := exec.Command(shell, "-c", "kill -KILL $$").Run()
+
+	info, ok := GetExitInfo(err)
+	require.True(t, ok)
+	require.True(t, info.Signaled)
+	require.Equal(t, syscall.SIGKILL, info.Signal)
+	require.Equal(t, -1, info.Code)
+
+	sig, ok := SignalStatus(err)
+	require.True(t, ok)
+	require.Equal(t, syscall.SIGKILL, sig)
+}
+
+func TestGetExitInfoNotExitError(t *testing.T) {
+	info, ok := GetExitInfo(errors.New("not an exit error"))
+	require.False(t, ok)
+	require.Equal(t, ExitInfo{}, info)
+
+	_, ok = ExitStatus(nil)
+	require.False(t, ok)
+}
+
+func TestRunTimeoutKillsProcessGroup(t *testing.T) {
+	if shell == "" || sleepbin == "" {
+		t.Skip("'sh' or 'sleep' binary not available on OS, skipping.")
+	}
+
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	cmd := exec.Command(shell, "-c", sleepbin+" 30 & echo $! > "+pidFile+"; wait")
+	start := time.Now()
+	err := RunTimeout(cmd, 200*time.Millisecond)
+	require.Equal(t, ErrTimeout, err)
+	require.Less(t, int64(time.Since(start)), int64(KillGrace))
+
+	b, err := os.ReadFile(pidFile)
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	require.NoError(t, err)
+
+	// the orphaned sleep is terminated along with the shell, it may linger
+	// as a zombie until it is reaped
+	require.Eventually(t, func() bool {
+		if err := syscall.Kill(pid, 0); err != nil {
+			return true
+		}
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		return err != nil || strings.Contains(string(stat), ") Z ")
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestSetProcessGroupKeepsAttributes(t *testing.T) {
+	cmd := exec.Command("true")
+	setProcessGroup(cmd)
+	require.Equal(t, &syscall.SysProcAttr{Setpgid: true}, cmd.SysProcAttr)
+
+	attr := &syscall.SysProcAttr{Setpgid: true, Pgid: 42}
+	cmd = exec.Command("true")
+	cmd.SysProcAttr = attr
+	setProcessGroup(cmd)
+	require.Same(t, attr, cmd.SysProcAttr)
+	require.Equal(t, &syscall.SysProcAttr{Setpgid: true, Pgid: 42}, cmd.SysProcAttr)
+
+	cmd = exec.Command("true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Noctty: true}
+	setProcessGroup(cmd)
+	require.False(t, cmd.SysProcAttr.Setpgid)
+}
+
+func TestRunTimeoutExitStatus(t *testing.T) {
+	if shell == "" {
+		t.Skip("'sh' binary not available on OS, skipping.")
+	}
+
+	err := RunTimeout(exec.Command(shell, "-c", "exit 3"), time.Second)
+	require.Error(t, err)
+	require.NotEqual(t, ErrTimeout, err)
+
+	code, ok := ExitStatus(err)
+	require.True(t, ok)
+	require.Equal(t, 3, code)
+}
+
+func TestRunTimeoutOutput(t *testing.T) {
+	if shell == "" {
+		t.Skip("'sh' binary not available on OS, skipping.")
+	}
+
+	stdout, stderr, err := RunTimeoutOutput(exec.Command(shell, "-c", "echo metrics; echo oops >&2"), time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "metrics\n", string(stdout))
+	require.Equal(t, "oops\n", string(stderr))
+
+	stdout, stderr, err = RunTimeoutOutput(exec.Command(shell, "-c", "echo partial; exit 2"), time.Second)
+	require.Error(t, err)
+	code, ok := ExitStatus(err)
+	require.True(t, ok)
+	require.Equal(t, 2, code)
+	require.Equal(t, "partial\n", string(stdout))
+	require.Empty(t, stderr)
+}
+
+func TestRunTimeoutOutputTimeout(t *testing.T) {
+	if shell == "" || sleepbin == "" {
+		t.Skip("'sh' or 'sleep' binary not available on OS, skipping.")
+	}
+
+	cmd := exec.Command(shell, "-c", "echo before; echo warn >&2; "+sleepbin+" 30")
+	stdout, stderr, err := RunTimeoutOutput(cmd, 200*time.Millisecond)
+	require.Equal(t, ErrTimeout, err)
+	require.Equal(t, "before\n", string(stdout))
+	require.Equal(t, "warn\n", string(stderr))
+}
+
+func TestRunTimeoutOutputLimit(t *testing.T) {
+	if shell == "" {
+		t.Skip("'sh' binary not available on OS, skipping.")
+	}
+
+	cmd := exec.Command(shell, "-c", "echo 0123456789; echo abcdefghij >&2")
+	stdout, stderr, err := RunTimeoutOutputLimit(cmd, time.Second, 4)
+	require.NoError(t, err)
+	require.Equal(t, "0123", string(stdout))
+	require.Equal(t, "abcd", string(stderr))
+}
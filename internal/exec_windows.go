@@ -41,3 +41,7 @@ func WaitTimeout(c *exec.Cmd, timeout time.Duration) error {
 	// Otherwise there was an error unrelated to termination.
 	return fmt.Errorf("cmd exec: %w", err)
 }
+
+// setProcessGroup is a no-op on windows, only the command process is killed
+// on timeout.
+func setProcessGroup(c *exec.Cmd) {}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+)
+
+// gatherIDRandLen is the length of the random suffix of a gather ID
+const gatherIDRandLen = 6
+
+// NewGatherID returns a short identifier suitable for correlating the log
+// lines emitted during a single gather. The ID is the current time in
+// milliseconds (base 36) followed by a random alpha-numeric suffix,
+// ie, "l8x2k9qz-Ab3dE9".
+func NewGatherID() string {
+	ts := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 36)
+	return ts + "-" + RandomString(gatherIDRandLen)
+}
+
+// WithGatherID returns a logger which prefixes every message with the
+// given gather ID, ie, "[l8x2k9qz-Ab3dE9] message".
+func WithGatherID(log cua.Logger, id string) cua.Logger {
+	return &prefixLogger{log: log, prefix: "[" + id + "] "}
+}
+
+// GatherSummary counts the metrics emitted and the errors encountered during
+// a single gather so they can be logged or recorded once it completes.
+type GatherSummary struct {
+	mu      sync.Mutex
+	start   time.Time
+	metrics int64
+	errors  int64
+	now     func() time.Time
+}
+
+// NewGatherSummary returns a summary of a gather starting now.
+func NewGatherSummary() *GatherSummary {
+	return &GatherSummary{
+		start: time.Now(),
+		now:   time.Now,
+	}
+}
+
+// AddMetrics adds n to the number of metrics emitted.
+func (g *GatherSummary) AddMetrics(n int) {
+	g.mu.Lock()
+	g.metrics += int64(n)
+	g.mu.Unlock()
+}
+
+// AddError counts err when it is not nil.
+func (g *GatherSummary) AddError(err error) {
+	if err == nil {
+		return
+	}
+	g.mu.Lock()
+	g.errors++
+	g.mu.Unlock()
+}
+
+// Counts returns the number of metrics emitted and errors encountered, and
+// the time elapsed since the start of the gather.
+func (g *GatherSummary) Counts() (metrics, errors int64, elapsed time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.metrics, g.errors, g.now().Sub(g.start)
+}
+
+// Log writes the summary to log at the debug level.
+func (g *GatherSummary) Log(log cua.Logger) {
+	metrics, errors, elapsed := g.Counts()
+	log.Debugf("Gathered %d metrics with %d errors in %s", metrics, errors, elapsed)
+}
+
+// Emit records the summary as a metric with the metrics_gathered, errors and
+// gather_time_ns fields.
+func (g *GatherSummary) Emit(acc cua.Accumulator, measurement string) {
+	metrics, errors, elapsed := g.Counts()
+	fields := map[string]interface{}{
+		"metrics_gathered": metrics,
+		"errors":           errors,
+		"gather_time_ns":   elapsed.Nanoseconds(),
+	}
+	acc.AddFields(measurement, fields, nil)
+}
+
+type prefixLogger struct {
+	log    cua.Logger
+	prefix string
+}
+
+func (l *prefixLogger) args(args []interface{}) []interface{} {
+	return append([]interface{}{l.prefix}, args...)
+}
+
+func (l *prefixLogger) Errorf(format string, args ...interface{}) {
+	l.log.Errorf(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Error(args ...interface{}) {
+	l.log.Error(l.args(args)...)
+}
+
+func (l *prefixLogger) Debugf(format string, args ...interface{}) {
+	l.log.Debugf(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Debug(args ...interface{}) {
+	l.log.Debug(l.args(args)...)
+}
+
+func (l *prefixLogger) Warnf(format string, args ...interface{}) {
+	l.log.Warnf(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Warn(args ...interface{}) {
+	l.log.Warn(l.args(args)...)
+}
+
+func (l *prefixLogger) Infof(format string, args ...interface{}) {
+	l.log.Infof(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Info(args ...interface{}) {
+	l.log.Info(l.args(args)...)
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGatherIDFormat(t *testing.T) {
+	re := regexp.MustCompile(`^[0-9a-z]+-[0-9A-Za-z]{6}$`)
+	id := NewGatherID()
+	require.True(t, re.MatchString(id), id)
+}
+
+func TestNewGatherIDUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 10000; i++ {
+		id := NewGatherID()
+		require.False(t, seen[id], "duplicate gather id %s", id)
+		seen[id] = true
+	}
+}
+
+func TestWithGatherID(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	logger := WithGatherID(testutil.Logger{Name: "test"}, "abc-123")
+
+	logger.Errorf("query %d failed", 1)
+	require.Contains(t, buf.String(), "[test] [abc-123] query 1 failed")
+
+	buf.Reset()
+	logger.Info("connected")
+	require.Contains(t, buf.String(), "[test] [abc-123] connected")
+}
+
+func newTestGatherSummary() (*GatherSummary, *time.Time) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := NewGatherSummary()
+	g.start = now
+	g.now = func() time.Time { return now }
+	return g, &now
+}
+
+func TestGatherSummaryCounts(t *testing.T) {
+	g, now := newTestGatherSummary()
+
+	g.AddMetrics(3)
+	g.AddMetrics(2)
+	g.AddError(nil)
+	g.AddError(errors.New("query failed"))
+	*now = now.Add(1500 * time.Millisecond)
+
+	metrics, errs, elapsed := g.Counts()
+	require.Equal(t, int64(5), metrics)
+	require.Equal(t, int64(1), errs)
+	require.Equal(t, 1500*time.Millisecond, elapsed)
+}
+
+func TestGatherSummaryLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	g, now := newTestGatherSummary()
+	g.AddMetrics(7)
+	g.AddError(errors.New("timeout"))
+	*now = now.Add(2 * time.Second)
+
+	g.Log(testutil.Logger{Name: "test"})
+	require.Contains(t, buf.String(), "Gathered 7 metrics with 1 errors in 2s")
+}
+
+func TestGatherSummaryEmit(t *testing.T) {
+	g, now := newTestGatherSummary()
+	g.AddMetrics(4)
+	*now = now.Add(250 * time.Millisecond)
+
+	var acc testutil.Accumulator
+	g.Emit(&acc, "postgresql_gather")
+
+	acc.AssertContainsFields(t, "postgresql_gather", map[string]interface{}{
+		"metrics_gathered": int64(4),
+		"errors":           int64(0),
+		"gather_time_ns":   int64(250 * time.Millisecond),
+	})
+}
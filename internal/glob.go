@@ -0,0 +1,18 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/circonus-labs/circonus-unified-agent/filter"
+)
+
+// GlobMatch reports whether s matches the glob pattern, where "*" matches any
+// sequence of characters and "?" a single character. The pattern is compiled
+// on every call, use the filter package to match a pattern repeatedly.
+func GlobMatch(pattern, s string) (bool, error) {
+	f, err := filter.Compile([]string{pattern})
+	if err != nil {
+		return false, fmt.Errorf("compile %q: %w", pattern, err)
+	}
+	return f.Match(s), nil
+}
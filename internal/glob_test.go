@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		s        string
+		expected bool
+	}{
+		{"cpu", "cpu", true},
+		{"cpu", "cpu0", false},
+		{"cpu*", "cpu0", true},
+		{"cpu?", "cpu0", true},
+		{"cpu?", "cpu10", false},
+		{"*_total", "bytes_total", true},
+		{"", "", true},
+		{"", "cpu", false},
+	}
+	for _, tt := range tests {
+		actual, err := GlobMatch(tt.pattern, tt.s)
+		require.NoError(t, err)
+		require.Equal(t, tt.expected, actual, "%q %q", tt.pattern, tt.s)
+	}
+
+	_, err := GlobMatch("cpu[", "cpu")
+	require.Error(t, err)
+}
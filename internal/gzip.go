@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// GzipCompressor gzips in memory payloads, reusing its gzip.Writers between
+// calls. It is intended for outputs compressing many small batches where the
+// per call writer and pipe of CompressWithGzip dominate. A GzipCompressor is
+// safe for concurrent use.
+type GzipCompressor struct {
+	level int
+	pool  sync.Pool
+}
+
+// NewGzipCompressor returns a GzipCompressor using the given compression
+// level, which must be gzip.DefaultCompression or between gzip.BestSpeed and
+// gzip.BestCompression.
+func NewGzipCompressor(level int) (*GzipCompressor, error) {
+	if level != gzip.DefaultCompression && (level < gzip.BestSpeed || level > gzip.BestCompression) {
+		return nil, fmt.Errorf("invalid gzip compression level %d, must be between %d and %d",
+			level, gzip.BestSpeed, gzip.BestCompression)
+	}
+
+	c := &GzipCompressor{level: level}
+	c.pool.New = func() interface{} {
+		// the level was validated above so this can't fail
+		w, _ := gzip.NewWriterLevel(io.Discard, level)
+		return w
+	}
+	return c, nil
+}
+
+// Compress returns the gzipped data.
+func (c *GzipCompressor) Compress(data []byte) ([]byte, error) {
+	w := c.pool.Get().(*gzip.Writer)
+	defer c.pool.Put(w)
+
+	var buf bytes.Buffer
+	w.Reset(&buf)
+
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("gzip write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("gzip close: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gunzip(t *testing.T, data []byte) string {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	defer gr.Close()
+	plain, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	return string(plain)
+}
+
+func TestGzipCompressor(t *testing.T) {
+	c, err := NewGzipCompressor(gzip.DefaultCompression)
+	require.NoError(t, err)
+
+	// the pooled writer must be reset between uses
+	for _, data := range []string{"the quick brown fox", "jumps over the lazy dog", ""} {
+		out, err := c.Compress([]byte(data))
+		require.NoError(t, err)
+		require.Equal(t, data, gunzip(t, out))
+	}
+}
+
+func TestGzipCompressorConcurrent(t *testing.T) {
+	c, err := NewGzipCompressor(gzip.BestSpeed)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				data := fmt.Sprintf("cpu,host=server%02d usage_idle=%d", i, j)
+				out, err := c.Compress([]byte(data))
+				if assert.NoError(t, err) {
+					assert.Equal(t, data, gunzip(t, out))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestGzipCompressorLevelInvalid(t *testing.T) {
+	for _, level := range []int{99, gzip.NoCompression, -5} {
+		_, err := NewGzipCompressor(level)
+		require.Error(t, err, "level %d", level)
+	}
+}
+
+var smallBatch = []byte("cpu,host=server01 usage_idle=98.2,usage_user=1.1\nmem,host=server01 used_percent=42.5\n")
+
+func BenchmarkGzipCompressor(b *testing.B) {
+	c, err := NewGzipCompressor(gzip.DefaultCompression)
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.Compress(smallBatch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompressWithGzip(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rc, err := CompressWithGzip(bytes.NewReader(smallBatch))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.ReadAll(rc); err != nil {
+			b.Fatal(err)
+		}
+		rc.Close()
+	}
+}
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// HashTags returns a stable 64-bit FNV-1a hash of a measurement name and tag
+// set, suitable for deduplicating or sharding series. The tags are hashed in
+// key order so the result does not depend on map iteration, and it equals
+// the HashID of a metric with the same name and tags.
+func HashTags(measurement string, tags map[string]string) uint64 {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(measurement))
+	_, _ = h.Write([]byte("\n"))
+	for _, k := range keys {
+		_, _ = h.Write([]byte(k))
+		_, _ = h.Write([]byte("\n"))
+		_, _ = h.Write([]byte(tags[k]))
+		_, _ = h.Write([]byte("\n"))
+	}
+	return h.Sum64()
+}
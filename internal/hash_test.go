@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashTagsOrderIndependent(t *testing.T) {
+	a := map[string]string{}
+	a["host"] = "server01"
+	a["region"] = "us-east"
+	a["cpu"] = "cpu0"
+
+	b := map[string]string{}
+	b["cpu"] = "cpu0"
+	b["region"] = "us-east"
+	b["host"] = "server01"
+
+	expected := HashTags("cpu", a)
+	for i := 0; i < 100; i++ {
+		require.Equal(t, expected, HashTags("cpu", a))
+		require.Equal(t, expected, HashTags("cpu", b))
+	}
+}
+
+func TestHashTagsDistinct(t *testing.T) {
+	tags := map[string]string{"host": "server01"}
+	hashes := map[uint64]string{}
+	for name, h := range map[string]uint64{
+		"base":            HashTags("cpu", tags),
+		"measurement":     HashTags("mem", tags),
+		"value":           HashTags("cpu", map[string]string{"host": "server02"}),
+		"key":             HashTags("cpu", map[string]string{"hostname": "server01"}),
+		"key value split": HashTags("cpu", map[string]string{"hos": "tserver01"}),
+		"extra tag":       HashTags("cpu", map[string]string{"host": "server01", "cpu": "cpu0"}),
+		"no tags":         HashTags("cpu", nil),
+	} {
+		other, ok := hashes[h]
+		require.False(t, ok, "%s collides with %s", name, other)
+		hashes[h] = name
+	}
+}
@@ -19,10 +19,16 @@ import (
 	"syscall"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/alecthomas/units"
+	"github.com/klauspost/compress/zstd"
 )
 
+// NowFunc returns the current time for the time dependent helpers of this
+// package, tests may override it to freeze the clock.
+var NowFunc = time.Now
+
 const alphanum string = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
 
 var (
@@ -31,11 +37,23 @@ var (
 	ErrNotImplemented = fmt.Errorf("not implemented yet")
 
 	ErrVersionAlreadySet = fmt.Errorf("version has already been set")
+
+	// ErrUnsupportedTimestampType is returned by ParseTimestamp when the
+	// timestamp value has a type the format can't be applied to, which
+	// usually points at a misconfigured format.
+	ErrUnsupportedTimestampType = fmt.Errorf("unsupported timestamp type")
+
+	// ErrTimestampParse is returned by ParseTimestamp when a timestamp value
+	// doesn't match the format.
+	ErrTimestampParse = fmt.Errorf("timestamp parse error")
 )
 
 // Set via the main module
 var version string
 
+// Appended to the product token, see SetProductSuffix
+var productSuffix string
+
 // Duration just wraps time.Duration
 type Duration struct {
 	Duration time.Duration
@@ -69,26 +87,49 @@ func Version() string {
 	return version
 }
 
-// ProductToken returns a tag for agent that can be used in user agents.
+// SetProductSuffix sets a custom suffix, ie, a deployment identifier, which
+// is appended to the product token. It is not thread-safe and should be set
+// once at startup.
+func SetProductSuffix(s string) {
+	productSuffix = strings.TrimSpace(s)
+}
+
+// ProductToken returns a tag for agent that can be used in user agents, ie,
+// "circonus-unified-agent/1.2.3 (linux; amd64) Go/1.20" followed by the
+// product suffix when set.
 func ProductToken() string {
-	return fmt.Sprintf("circonus-unified-agent/%s Go/%s",
-		Version(), strings.TrimPrefix(runtime.Version(), "go"))
+	token := fmt.Sprintf("circonus-unified-agent/%s (%s; %s) Go/%s",
+		Version(), runtime.GOOS, runtime.GOARCH, strings.TrimPrefix(runtime.Version(), "go"))
+	if productSuffix != "" {
+		token += " " + productSuffix
+	}
+	return token
 }
 
-// UnmarshalTOML parses the duration from the TOML config file
+// UnmarshalTOML parses the duration from the TOML config file. In addition to
+// the units of time.ParseDuration, "d" (24h) and "w" (168h) are accepted and
+// may be combined with the other units, ie, "1d12h".
 func (d *Duration) UnmarshalTOML(b []byte) error {
 	var err error
 	b = bytes.Trim(b, `'`)
+	// an empty string leaves the duration unset
+	if len(b) == 0 {
+		return nil
+	}
 
 	// see if we can directly convert it
-	d.Duration, err = time.ParseDuration(string(b))
+	d.Duration, err = parseDuration(string(b))
 	if err == nil {
 		return nil
 	}
 
 	// Parse string duration, ie, "1s"
-	if uq, err := strconv.Unquote(string(b)); err == nil && len(uq) > 0 {
-		d.Duration, err = time.ParseDuration(uq)
+	if uq, err := strconv.Unquote(string(b)); err == nil {
+		// an empty string leaves the duration unset
+		if uq == "" {
+			return nil
+		}
+		d.Duration, err = parseDuration(uq)
 		if err == nil {
 			return nil
 		}
@@ -103,19 +144,71 @@ func (d *Duration) UnmarshalTOML(b []byte) error {
 	// Second try parsing as float seconds
 	sF, err := strconv.ParseFloat(string(b), 64)
 	if err == nil {
-		d.Duration = time.Second * time.Duration(sF)
+		d.Duration = time.Duration(sF * float64(time.Second))
 		return nil
 	}
 
-	return nil
+	return fmt.Errorf("invalid duration %s", string(b))
 }
 
+// parseDuration is time.ParseDuration with support for the day and week units,
+// which are converted to hours before parsing.
+func parseDuration(s string) (time.Duration, error) {
+	if !strings.ContainsAny(s, "dw") {
+		return time.ParseDuration(s) //nolint:wrapcheck
+	}
+
+	var sb strings.Builder
+	rest := s
+	if rest != "" && (rest[0] == '-' || rest[0] == '+') {
+		sb.WriteByte(rest[0])
+		rest = rest[1:]
+	}
+	for rest != "" {
+		i := 0
+		for i < len(rest) && (rest[i] == '.' || ('0' <= rest[i] && rest[i] <= '9')) {
+			i++
+		}
+		j := i
+		for j < len(rest) && rest[j] != '.' && (rest[j] < '0' || rest[j] > '9') {
+			j++
+		}
+		number, unit := rest[:i], rest[i:j]
+		rest = rest[j:]
+
+		hours := 0.0
+		switch unit {
+		case "d":
+			hours = 24
+		case "w":
+			hours = 7 * 24
+		default:
+			sb.WriteString(number)
+			sb.WriteString(unit)
+			continue
+		}
+		v, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		sb.WriteString(strconv.FormatFloat(v*hours, 'f', -1, 64))
+		sb.WriteString("h")
+	}
+	return time.ParseDuration(sb.String()) //nolint:wrapcheck
+}
+
+// UnmarshalTOML parses the size from the TOML config file, the size is either
+// a number of bytes or a human readable size which may be fractional, ie,
+// "1.5GB". Negative sizes are rejected.
 func (s *Size) UnmarshalTOML(b []byte) error {
 	var err error
 	b = bytes.Trim(b, `'`)
 
 	val, err := strconv.ParseInt(string(b), 10, 64)
 	if err == nil {
+		if val < 0 {
+			return fmt.Errorf("negative size (%s) not allowed", string(b))
+		}
 		s.Size = val
 		return nil
 	}
@@ -123,21 +216,79 @@ func (s *Size) UnmarshalTOML(b []byte) error {
 	if err != nil {
 		return fmt.Errorf("unquote (%s): %w", string(b), err)
 	}
+	if strings.HasPrefix(strings.TrimSpace(uq), "-") {
+		return fmt.Errorf("negative size (%s) not allowed", uq)
+	}
 	val, err = units.ParseStrictBytes(uq)
 	if err != nil {
+		if val, ferr := parseFractionalBytes(uq); ferr == nil {
+			s.Size = val
+			return nil
+		}
 		return fmt.Errorf("parsestrictbytes (%s): %w", uq, err)
 	}
 	s.Size = val
 	return nil
 }
 
+// parseFractionalBytes parses a fractional human readable size, ie, "1.5GB",
+// rounding it to the nearest byte.
+func parseFractionalBytes(size string) (int64, error) {
+	size = strings.TrimSpace(size)
+	i := strings.IndexFunc(size, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if i <= 0 {
+		return 0, fmt.Errorf("invalid size (%s)", size)
+	}
+
+	value, err := strconv.ParseFloat(size[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsefloat (%s): %w", size[:i], err)
+	}
+	magnitude, err := units.ParseStrictBytes("1" + strings.TrimSpace(size[i:]))
+	if err != nil {
+		return 0, fmt.Errorf("parsestrictbytes (%s): %w", size[i:], err)
+	}
+
+	n := math.Round(value * float64(magnitude))
+	if n >= math.MaxInt64 {
+		return 0, fmt.Errorf("size (%s) out of range", size)
+	}
+	return int64(n), nil
+}
+
+// numberMultipliers are the suffixes accepted by Number.UnmarshalTOML
+var numberMultipliers = map[byte]float64{
+	'k': 1e3,
+	'M': 1e6,
+	'G': 1e9,
+}
+
+// UnmarshalTOML parses the number from the TOML config file. The number may
+// be quoted, contain thousands separators, ie, "1,000", and end with one of
+// the k, M or G multipliers, ie, "2k".
 func (n *Number) UnmarshalTOML(b []byte) error {
-	value, err := strconv.ParseFloat(string(b), 64)
+	s := string(bytes.Trim(b, `'`))
+	if uq, err := strconv.Unquote(s); err == nil {
+		s = uq
+	}
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+
+	multiplier := 1.0
+	if len(s) > 1 {
+		if m, ok := numberMultipliers[s[len(s)-1]]; ok {
+			multiplier = m
+			s = s[:len(s)-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
 	if err != nil {
 		return fmt.Errorf("parsefloat (%s): %w", string(b), err)
 	}
 
-	n.Value = value
+	n.Value = value * multiplier
 	return nil
 }
 
@@ -156,35 +307,76 @@ func ReadLines(filename string) ([]string, error) {
 func ReadLinesOffsetN(filename string, offset uint, n int) ([]string, error) {
 	f, err := os.Open(filename)
 	if err != nil {
-		return []string{""}, fmt.Errorf("open (%s): %w", filename, err)
+		return nil, fmt.Errorf("open (%s): %w", filename, err)
 	}
 	defer f.Close()
 
+	return ReadLinesReader(f, offset, n)
+}
+
+// ReadLinesReader reads contents from r and splits them by new line, the
+// offset and count have the same meaning as for ReadLinesOffsetN. A byte order
+// mark at the start of the contents is removed.
+func ReadLinesReader(r io.Reader, offset uint, n int) ([]string, error) {
 	var ret []string
 
-	r := bufio.NewReader(f)
+	br := bufio.NewReader(r)
 	for i := 0; i < n+int(offset) || n < 0; i++ {
-		line, err := r.ReadString('\n')
-		if err != nil {
+		line, err := br.ReadString('\n')
+		// the last line may not be terminated by a new line
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
 			break
 		}
-		if i < int(offset) {
-			continue
+		if i == 0 {
+			line = string(StripBOM([]byte(line)))
+		}
+		if i >= int(offset) {
+			ret = append(ret, strings.Trim(line, "\n"))
+		}
+		if err != nil {
+			break
 		}
-		ret = append(ret, strings.Trim(line, "\n"))
 	}
 
 	return ret, nil
 }
 
+// utf8BOM is the byte order mark some editors, mostly on Windows, write at
+// the start of UTF-8 files.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// StripBOM returns b without its leading UTF-8 byte order mark, if any.
+func StripBOM(b []byte) []byte {
+	return bytes.TrimPrefix(b, utf8BOM)
+}
+
 // RandomString returns a random string of alpha-numeric characters
 func RandomString(n int) string {
-	var bytes = make([]byte, n)
-	rand.Read(bytes) //nolint:gosec // G404
-	for i, b := range bytes {
-		bytes[i] = alphanum[b%byte(len(alphanum))]
+	return RandomStringUnbiased(n)
+}
+
+// RandomStringUnbiased returns a random string of alpha-numeric characters
+// where every character is equally likely. Random bytes beyond the largest
+// multiple of len(alphanum) are rejected so mapping the remaining bytes onto
+// alphanum is not biased toward its first characters.
+func RandomStringUnbiased(n int) string {
+	const limit = 256 - 256%len(alphanum)
+
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(out) < n {
+		rand.Read(buf) //nolint:gosec // G404
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			out = append(out, alphanum[int(b)%len(alphanum)])
+			if len(out) == n {
+				break
+			}
+		}
 	}
-	return string(bytes)
+	return string(out)
 }
 
 // SnakeCase converts the given string to snake case following the Golang format:
@@ -195,8 +387,18 @@ func SnakeCase(in string) string {
 
 	var out []rune
 	for i := 0; i < length; i++ {
-		if i > 0 && unicode.IsUpper(runes[i]) && ((i+1 < length && unicode.IsLower(runes[i+1])) || unicode.IsLower(runes[i-1])) {
-			out = append(out, '_')
+		if i > 0 && unicode.IsUpper(runes[i]) && runes[i-1] != '_' {
+			prev := runes[i-1]
+			switch {
+			// start of a word after a lower case letter or a digit,
+			// ie, "userID" or "field2Name"
+			case unicode.IsLower(prev) || unicode.IsDigit(prev):
+				out = append(out, '_')
+			// last upper case letter of an acronym starts the next
+			// word, ie, "HTTPServer"
+			case unicode.IsUpper(prev) && i+1 < length && unicode.IsLower(runes[i+1]):
+				out = append(out, '_')
+			}
 		}
 		out = append(out, unicode.ToLower(runes[i]))
 	}
@@ -204,24 +406,116 @@ func SnakeCase(in string) string {
 	return string(out)
 }
 
+// SanitizeMeasurementName normalizes a measurement name built from user input:
+// the name is lower cased, every rune other than a letter, digit or underscore
+// is replaced by an underscore, runs of underscores are collapsed and leading
+// or trailing underscores are removed, ie, "Query Stats.v2" becomes
+// "query_stats_v2". Unicode letters and digits are kept.
+func SanitizeMeasurementName(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s))
+
+	underscore := false
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			underscore = sb.Len() > 0
+			continue
+		}
+		if underscore {
+			sb.WriteByte('_')
+			underscore = false
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	return sb.String()
+}
+
+// TruncateString returns s cut to at most max bytes, the cut is moved back to
+// a rune boundary so a multibyte character is never split, ie, for tag values
+// limited in length downstream.
+func TruncateString(s string, max int) string {
+	return TruncateStringMarker(s, max, "")
+}
+
+// TruncateStringMarker is TruncateString appending marker, ie, "...", to a
+// truncated string, the marker counting toward max. The marker is left out
+// when it does not fit in max.
+func TruncateStringMarker(s string, max int, marker string) string {
+	if max <= 0 {
+		return ""
+	}
+	if len(s) <= max {
+		return s
+	}
+	if len(marker) >= max {
+		marker = ""
+	}
+
+	cut := max - len(marker)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + marker
+}
+
+// FirstNonEmpty returns the first of the values which is not empty, or an
+// empty string when they all are, ie, for an option falling back to another
+// option and then to a default.
+func FirstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Dedup returns the strings of in without duplicates, keeping the first
+// occurrence of each so the order is preserved. The input is not modified.
+func Dedup(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(in))
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		out = append(out, s)
+	}
+	return out
+}
+
 // RandomSleep will sleep for a random amount of time up to max.
 // If the shutdown channel is closed, it will return before it has finished
 // sleeping.
 func RandomSleep(max time.Duration, shutdown chan struct{}) {
-	if max == 0 {
+	if max <= 0 {
 		return
 	}
 
-	sleepns := rand.Int63n(max.Nanoseconds()) //nolint:gosec // G404
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-	t := time.NewTimer(time.Nanosecond * time.Duration(sleepns))
-	select {
-	case <-t.C:
-		return
-	case <-shutdown:
-		t.Stop()
-		return
+	_ = RandomSleepContext(ctx, max)
+}
+
+// RandomSleepContext sleeps for a random amount of time up to max, returning
+// the context error if the context is closed before it has finished sleeping.
+func RandomSleepContext(ctx context.Context, max time.Duration) error {
+	if max <= 0 {
+		return nil
 	}
+	return SleepContext(ctx, RandomDuration(max))
 }
 
 // RandomDuration returns a random duration between 0 and max.
@@ -254,65 +548,220 @@ func SleepContext(ctx context.Context, duration time.Duration) error {
 // AlignDuration returns the duration until next aligned interval.
 // If the current time is aligned a 0 duration is returned.
 func AlignDuration(tm time.Time, interval time.Duration) time.Duration {
-	return AlignTime(tm, interval).Sub(tm)
+	return AlignDurationWithOffset(tm, interval, 0)
 }
 
 // AlignTime returns the time of the next aligned interval.
 // If the current time is aligned the current time is returned.
 func AlignTime(tm time.Time, interval time.Duration) time.Time {
-	truncated := tm.Truncate(interval)
-	if truncated == tm {
+	return AlignTimeWithOffset(tm, interval, 0)
+}
+
+// AlignDurationNow returns the duration from NowFunc until the next aligned
+// interval.
+func AlignDurationNow(interval time.Duration) time.Duration {
+	return AlignDuration(NowFunc(), interval)
+}
+
+// AlignTimeNow returns the time of the next aligned interval after NowFunc.
+func AlignTimeNow(interval time.Duration) time.Time {
+	return AlignTime(NowFunc(), interval)
+}
+
+// ContextWithInterval returns a context whose deadline is the next aligned
+// interval boundary after NowFunc, so a gather is bounded by its collection
+// window. At a boundary the deadline is a whole interval away. An interval
+// of zero or less sets no deadline.
+func ContextWithInterval(parent context.Context, interval time.Duration) (context.Context, context.CancelFunc) {
+	if interval <= 0 {
+		return context.WithCancel(parent)
+	}
+	now := NowFunc()
+	deadline := AlignTime(now, interval)
+	if !deadline.After(now) {
+		deadline = deadline.Add(interval)
+	}
+	return context.WithDeadline(parent, deadline)
+}
+
+// AlignDurationWithOffset returns the duration until next aligned interval
+// shifted by offset, see AlignTimeWithOffset.
+func AlignDurationWithOffset(tm time.Time, interval, offset time.Duration) time.Duration {
+	return AlignTimeWithOffset(tm, interval, offset).Sub(tm)
+}
+
+// AlignTimeWithOffset returns the time of the next aligned interval with the
+// alignment grid shifted by offset, ie, a 1m interval with a 15s offset aligns
+// to 15s past each minute. The offset wraps around the interval and may be
+// negative. If the current time is aligned the current time is returned.
+func AlignTimeWithOffset(tm time.Time, interval, offset time.Duration) time.Time {
+	if interval <= 0 {
+		return tm
+	}
+
+	offset %= interval
+	if offset < 0 {
+		offset += interval
+	}
+
+	shifted := tm.Add(-offset)
+	truncated := shifted.Truncate(interval)
+	if truncated == shifted {
 		return tm
 	}
-	return truncated.Add(interval)
+	return truncated.Add(interval + offset)
+}
+
+// IntervalsIn returns the number of whole collection intervals needed to
+// cover the duration d. Partial intervals are rounded up so that a duration is
+// never under-counted. A zero or negative interval or duration returns 0.
+func IntervalsIn(d, interval time.Duration) int {
+	if interval <= 0 || d <= 0 {
+		return 0
+	}
+	n := d / interval
+	if d%interval != 0 {
+		n++
+	}
+	return int(n)
 }
 
 // Exit status takes the error from exec.Command
 // and returns the exit status and true
 // if error is not exit status, will return 0 and false
 func ExitStatus(err error) (int, bool) {
+	info, ok := GetExitInfo(err)
+	return info.Code, ok
+}
+
+// ExitInfo describes how a process terminated.
+type ExitInfo struct {
+	// Code is the exit status, -1 when the process was killed by a signal.
+	Code int
+	// Signaled is set when the process was terminated by Signal.
+	Signaled bool
+	Signal   syscall.Signal
+}
+
+// GetExitInfo takes the error from exec.Command and returns how the process
+// terminated and true, if error is not exit status, will return an empty
+// ExitInfo and false.
+func GetExitInfo(err error) (ExitInfo, bool) {
 	var eerr *exec.ExitError
 	if errors.As(err, &eerr) {
 		if status, ok := eerr.Sys().(syscall.WaitStatus); ok {
-			return status.ExitStatus(), true
+			info := ExitInfo{
+				Code:     status.ExitStatus(),
+				Signaled: status.Signaled(),
+			}
+			if info.Signaled {
+				info.Signal = status.Signal()
+			}
+			return info, true
 		}
 	}
-	return 0, false
+	return ExitInfo{}, false
+}
+
+// SignalStatus takes the error from exec.Command and returns the signal which
+// terminated the process and true, if the process was not terminated by a
+// signal, will return 0 and false.
+func SignalStatus(err error) (syscall.Signal, bool) {
+	info, ok := GetExitInfo(err)
+	if !ok || !info.Signaled {
+		return 0, false
+	}
+	return info.Signal, true
+}
+
+func (r *ReadWaitCloser) Read(p []byte) (int, error) {
+	return r.pipeReader.Read(p) //nolint:wrapcheck
 }
 
 func (r *ReadWaitCloser) Close() error {
 	err := r.pipeReader.Close()
-	r.wg.Wait() // wait for the gzip goroutine finish
+	r.wg.Wait() // wait for the compression goroutine finish
 	if err != nil {
 		return fmt.Errorf("close: %w", err)
 	}
 	return nil
 }
 
+// Compress takes an io.Reader as input and pipes it through the given
+// compression algorithm, one of "gzip", "zstd" or "none", returning an
+// io.ReadCloser containing the compressed data.
+func Compress(data io.Reader, algorithm string) (io.ReadCloser, error) {
+	switch algorithm {
+	case "gzip":
+		return CompressWithGzip(data)
+	case "zstd":
+		return CompressWithZstd(data)
+	case "none", "identity", "":
+		return io.NopCloser(data), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm %q", algorithm)
+	}
+}
+
 // CompressWithGzip takes an io.Reader as input and pipes
 // it through a gzip.Writer returning an io.Reader containing
 // the gzipped data.
 // An error is returned if passing data to the gzip.Writer fails
 func CompressWithGzip(data io.Reader) (io.ReadCloser, error) {
+	return CompressWithGzipLevel(data, gzip.DefaultCompression)
+}
+
+// CompressWithGzipLevel is CompressWithGzip using the given compression
+// level, which must be gzip.DefaultCompression or between gzip.BestSpeed and
+// gzip.BestCompression.
+func CompressWithGzipLevel(data io.Reader, level int) (io.ReadCloser, error) {
+	if level != gzip.DefaultCompression && (level < gzip.BestSpeed || level > gzip.BestCompression) {
+		return nil, fmt.Errorf("invalid gzip compression level %d, must be between %d and %d",
+			level, gzip.BestSpeed, gzip.BestCompression)
+	}
+	return compressWithWriter(data, func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, level) //nolint:wrapcheck
+	})
+}
+
+// CompressWithZstd takes an io.Reader as input and pipes
+// it through a zstd.Encoder returning an io.Reader containing
+// the zstd compressed data.
+// An error is returned if passing data to the zstd.Encoder fails
+func CompressWithZstd(data io.Reader) (io.ReadCloser, error) {
+	return compressWithWriter(data, func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	})
+}
+
+// compressWithWriter copies data through the compressing writer returned by
+// newWriter in a background goroutine. Errors reading from data or writing to
+// the compressor are returned from reads of the returned ReadCloser, closing
+// it stops the goroutine and waits for it to finish.
+func compressWithWriter(data io.Reader, newWriter func(io.Writer) (io.WriteCloser, error)) (io.ReadCloser, error) {
 	pipeReader, pipeWriter := io.Pipe()
-	gzipWriter := gzip.NewWriter(pipeWriter)
+	compressor, err := newWriter(pipeWriter)
+	if err != nil {
+		return nil, fmt.Errorf("new writer: %w", err)
+	}
 
 	rc := &ReadWaitCloser{
 		pipeReader: pipeReader,
 	}
 
 	rc.wg.Add(1)
-	var err error
 	go func() {
-		_, err = io.Copy(gzipWriter, data)
-		gzipWriter.Close()
+		_, err := io.Copy(compressor, data)
+		if cerr := compressor.Close(); err == nil {
+			err = cerr
+		}
 		// subsequent reads from the read half of the pipe will
 		// return no bytes and the error err, or EOF if err is nil.
 		_ = pipeWriter.CloseWithError(err)
 		rc.wg.Done()
 	}()
 
-	return pipeReader, err //nolint:wrapcheck
+	return rc, nil
 }
 
 // ParseTimestamp parses a Time according to the standard agent options.
@@ -322,22 +771,69 @@ func CompressWithGzip(data io.Reader) (io.ReadCloser, error) {
 //	json_time_format = "2006-01-02T15:04:05Z07:00"
 //	json_timezone = "America/Los_Angeles"
 //
-// The format can be one of "unix", "unix_ms", "unix_us", "unix_ns", or a Go
-// time layout suitable for time.Parse.
+// The format can be one of "unix", "unix_s", "unix_ms", "unix_us", "unix_ns",
+// "unix_auto", "rfc3339", "rfc3339nano", or a Go time layout suitable for
+// time.Parse.
+//
+// The "rfc3339" and "rfc3339nano" formats use the offset embedded in the
+// timestamp and ignore the location, both accept an optional fractional
+// second.
 //
 // When using the "unix" format, a optional fractional component is allowed.
 // Specific unix time precisions cannot have a fractional component.
 //
+// The "unix_auto" format guesses the precision of a unix time from the
+// magnitude of its integer part: above 1e18 it is in nanoseconds, above 1e15
+// in microseconds, above 1e12 in milliseconds and seconds otherwise. The
+// guess holds for times between September 2001, where each unit crosses its
+// boundary, and the year 33658, where seconds reach 1e12, except that an int64
+// of nanoseconds ends in April 2262; earlier sub-second times are taken for a
+// larger unit. Only seconds may have a fractional component.
+//
 // Unix times may be an int64, float64, or string.  When using a Go format
-// string the timestamp must be a string.
+// string the timestamp must be a string.  With any format the timestamp may
+// also be a time.Time or *time.Time, which is returned in UTC for the unix
+// formats, as is for the rfc3339 formats and in the location otherwise.
 //
 // The location is a location string suitable for time.LoadLocation.  Unix
 // times do not use the location string, a unix time is always return in the
 // UTC location.
+//
+// Errors wrap ErrUnsupportedTimestampType or ErrTimestampParse, the latter
+// also wrapping the underlying strconv or time error for errors.Is and
+// errors.As.
 func ParseTimestamp(format string, timestamp interface{}, location string) (time.Time, error) {
+	return ParseTimestampWithSeparator(format, timestamp, location, "")
+}
+
+// ParseTimestampWithSeparator is ParseTimestamp with the decimal separator of
+// unix string timestamps given explicitly. The separator is either "." or ","
+// and the other character is then treated as a thousands separator, ie,
+// "1,234.5" with "." or "1.234,5" with ",". An empty separator accepts both
+// '.' and ',' as the decimal point.
+func ParseTimestampWithSeparator(format string, timestamp interface{}, location, separator string) (time.Time, error) {
+	switch separator {
+	case "", ".", ",":
+	default:
+		return time.Unix(0, 0), fmt.Errorf("invalid decimal separator %q", separator)
+	}
+
+	// a timestamp which is already a time only needs its location adjusted
+	switch ts := timestamp.(type) {
+	case *time.Time:
+		if ts == nil {
+			return time.Unix(0, 0), fmt.Errorf("%w: nil %T", ErrUnsupportedTimestampType, timestamp)
+		}
+		return timeInLocation(format, *ts, location)
+	case time.Time:
+		return timeInLocation(format, ts, location)
+	}
+
 	switch format {
-	case "unix", "unix_ms", "unix_us", "unix_ns":
-		return parseUnix(format, timestamp)
+	case "unix", "unix_s", "unix_ms", "unix_us", "unix_ns", "unix_auto":
+		return parseUnix(format, timestamp, separator)
+	case "rfc3339", "rfc3339nano":
+		return parseRFC3339(timestamp)
 	default:
 		if location == "" {
 			location = "UTC"
@@ -346,14 +842,82 @@ func ParseTimestamp(format string, timestamp interface{}, location string) (time
 	}
 }
 
-func parseUnix(format string, timestamp interface{}) (time.Time, error) {
-	integer, fractional, err := parseComponents(timestamp)
+// ParseTimestampAny parses a Time with the first of the formats accepting
+// the timestamp, trying them in order, so that data mixing similar formats,
+// ie, with and without fractional seconds, can be parsed. The formats are
+// those of ParseTimestamp. When no format matches the errors of every format
+// are returned as a MultiError.
+func ParseTimestampAny(formats []string, timestamp interface{}, location string) (time.Time, error) {
+	if len(formats) == 0 {
+		return time.Unix(0, 0), fmt.Errorf("no timestamp formats")
+	}
+
+	errs := make(MultiError, 0, len(formats))
+	for _, format := range formats {
+		tm, err := ParseTimestamp(format, timestamp, location)
+		if err == nil {
+			return tm, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", format, err))
+	}
+	return time.Unix(0, 0), errs
+}
+
+// timeInLocation returns the time in UTC for the unix formats, as is for the
+// rfc3339 formats which carry their offset, and in the location otherwise.
+func timeInLocation(format string, tm time.Time, location string) (time.Time, error) {
+	switch format {
+	case "unix", "unix_s", "unix_ms", "unix_us", "unix_ns", "unix_auto":
+		return tm.UTC(), nil
+	case "rfc3339", "rfc3339nano":
+		return tm, nil
+	}
+	if location == "" {
+		location = "UTC"
+	}
+	loc, err := time.LoadLocation(location)
+	if err != nil {
+		return time.Unix(0, 0), fmt.Errorf("loadlocation (%s): %w", location, err)
+	}
+	return tm.In(loc), nil
+}
+
+func parseUnix(format string, timestamp interface{}, separator string) (time.Time, error) {
+	format = strings.ToLower(format)
+
+	decimals := ".,"
+	if ts, ok := timestamp.(string); ok && separator != "" {
+		thousands := ","
+		if separator == "," {
+			thousands = "."
+		}
+		timestamp = strings.ReplaceAll(ts, thousands, "")
+		decimals = separator
+	}
+
+	// Only second precision may carry a fractional component, silently
+	// dropping it for the smaller units hides a misconfigured format.
+	if ts, ok := timestamp.(string); ok && format != "unix" && format != "unix_s" && format != "unix_auto" {
+		if strings.ContainsAny(ts, decimals) {
+			return time.Unix(0, 0), fmt.Errorf("%w: fractional component not allowed for %s", ErrTimestampParse, format)
+		}
+	}
+
+	// Epoch seconds encoded as floats by JSON sources may use scientific
+	// notation (ie, "1.6340256e9") which can't be split on the decimal point.
+	if ts, ok := timestamp.(string); ok && (format == "unix" || format == "unix_s" || format == "unix_auto") && strings.ContainsAny(ts, "eE") {
+		if f, err := strconv.ParseFloat(ts, 64); err == nil {
+			timestamp = f
+		}
+	}
+
+	integer, fractional, err := parseComponents(timestamp, separator)
 	if err != nil {
 		return time.Unix(0, 0), err
 	}
 
-	switch strings.ToLower(format) {
-	case "unix":
+	switch format {
+	case "unix", "unix_s":
 		return time.Unix(integer, fractional).UTC(), nil
 	case "unix_ms":
 		return time.Unix(0, integer*1e6).UTC(), nil
@@ -361,32 +925,86 @@ func parseUnix(format string, timestamp interface{}) (time.Time, error) {
 		return time.Unix(0, integer*1e3).UTC(), nil
 	case "unix_ns":
 		return time.Unix(0, integer).UTC(), nil
+	case "unix_auto":
+		return parseUnixAuto(integer, fractional)
+	default:
+		return time.Unix(0, 0), fmt.Errorf("%w: %T", ErrUnsupportedTimestampType, timestamp)
+	}
+}
+
+// parseUnixAuto returns the unix time in the precision guessed from the
+// magnitude of the integer, see ParseTimestamp for the boundaries.
+func parseUnixAuto(integer, fractional int64) (time.Time, error) {
+	magnitude := integer
+	if magnitude < 0 {
+		magnitude = -magnitude
+	}
+
+	// perSecond units make a second, each of scale nanoseconds
+	var perSecond, scale int64
+	switch {
+	case magnitude > 1e18:
+		perSecond, scale = 1e9, 1
+	case magnitude > 1e15:
+		perSecond, scale = 1e6, 1e3
+	case magnitude > 1e12:
+		perSecond, scale = 1e3, 1e6
 	default:
-		return time.Unix(0, 0), fmt.Errorf("unsupported type")
+		return time.Unix(integer, fractional).UTC(), nil
+	}
+	if fractional != 0 {
+		return time.Unix(0, 0), fmt.Errorf("%w: fractional component not allowed for sub-second unix_auto time %d", ErrTimestampParse, integer)
+	}
+	// split off the seconds so that the nanoseconds do not overflow an int64
+	return time.Unix(integer/perSecond, (integer%perSecond)*scale).UTC(), nil
+}
+
+// timestampParseError is an ErrTimestampParse caused by err, ie, a
+// *strconv.NumError or a *time.ParseError, which errors.As still finds.
+type timestampParseError struct {
+	msg string
+	err error
+}
+
+func (e *timestampParseError) Error() string {
+	if e.msg == "" {
+		return ErrTimestampParse.Error() + ": " + e.err.Error()
 	}
+	return ErrTimestampParse.Error() + ": " + e.msg + ": " + e.err.Error()
+}
+
+// Is reports whether target is ErrTimestampParse.
+func (e *timestampParseError) Is(target error) bool {
+	return target == ErrTimestampParse
 }
 
-// Returns the integers before and after an optional decimal point.  Both '.'
-// and ',' are supported for the decimal point.  The timestamp can be an int64,
-// float64, or string.
+func (e *timestampParseError) Unwrap() error {
+	return e.err
+}
+
+// Returns the integers before and after an optional decimal point.  When the
+// separator is empty both '.' and ',' are supported for the decimal point,
+// otherwise only the separator is.  The timestamp can be an int64, float64,
+// or string.
 //
 //	ex: "42.5" -> (42, 5, nil)
-func parseComponents(timestamp interface{}) (int64, int64, error) {
+func parseComponents(timestamp interface{}, separator string) (int64, int64, error) {
 	switch ts := timestamp.(type) {
 	case string:
-		parts := strings.SplitN(ts, ".", 2)
-		if len(parts) == 2 {
-			return parseUnixTimeComponents(parts[0], parts[1])
+		separators := []string{".", ","}
+		if separator != "" {
+			separators = []string{separator}
 		}
-
-		parts = strings.SplitN(ts, ",", 2)
-		if len(parts) == 2 {
-			return parseUnixTimeComponents(parts[0], parts[1])
+		for _, sep := range separators {
+			parts := strings.SplitN(ts, sep, 2)
+			if len(parts) == 2 {
+				return parseUnixTimeComponents(parts[0], parts[1])
+			}
 		}
 
 		integer, err := strconv.ParseInt(ts, 10, 64)
 		if err != nil {
-			return 0, 0, fmt.Errorf("parseint (%s): %w", ts, err)
+			return 0, 0, &timestampParseError{msg: fmt.Sprintf("parseint (%s)", ts), err: err}
 		}
 		return integer, 0, nil
 	case int64:
@@ -395,14 +1013,14 @@ func parseComponents(timestamp interface{}) (int64, int64, error) {
 		integer, fractional := math.Modf(ts)
 		return int64(integer), int64(fractional * 1e9), nil
 	default:
-		return 0, 0, fmt.Errorf("unsupported type")
+		return 0, 0, fmt.Errorf("%w: %T", ErrUnsupportedTimestampType, timestamp)
 	}
 }
 
 func parseUnixTimeComponents(first, second string) (int64, int64, error) {
 	integer, err := strconv.ParseInt(first, 10, 64)
 	if err != nil {
-		return 0, 0, fmt.Errorf("parseint (%s): %w", first, err)
+		return 0, 0, &timestampParseError{msg: fmt.Sprintf("parseint (%s)", first), err: err}
 	}
 
 	// Convert to nanoseconds, dropping any greater precision.
@@ -411,11 +1029,24 @@ func parseUnixTimeComponents(first, second string) (int64, int64, error) {
 
 	fractional, err := strconv.ParseInt(string(buf), 10, 64)
 	if err != nil {
-		return 0, 0, fmt.Errorf("parseint (%s): %w", string(buf), err)
+		return 0, 0, &timestampParseError{msg: fmt.Sprintf("parseint (%s)", string(buf)), err: err}
 	}
 	return integer, fractional, nil
 }
 
+// parseRFC3339 parses a RFC3339 string timestamp in its embedded offset.
+func parseRFC3339(timestamp interface{}) (time.Time, error) {
+	ts, ok := timestamp.(string)
+	if !ok {
+		return time.Unix(0, 0), fmt.Errorf("%w: %T", ErrUnsupportedTimestampType, timestamp)
+	}
+	tm, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Unix(0, 0), &timestampParseError{msg: fmt.Sprintf("parse rfc3339 (%s)", ts), err: err}
+	}
+	return tm, nil
+}
+
 // ParseTime parses a string timestamp according to the format string.
 func parseTime(format string, timestamp interface{}, location string) (time.Time, error) {
 	switch ts := timestamp.(type) {
@@ -424,8 +1055,12 @@ func parseTime(format string, timestamp interface{}, location string) (time.Time
 		if err != nil {
 			return time.Unix(0, 0), fmt.Errorf("loadlocation (%s): %w", location, err)
 		}
-		return time.ParseInLocation(format, ts, loc)
+		tm, err := time.ParseInLocation(format, ts, loc)
+		if err != nil {
+			return time.Unix(0, 0), &timestampParseError{err: err}
+		}
+		return tm, nil
 	default:
-		return time.Unix(0, 0), fmt.Errorf("unsupported type")
+		return time.Unix(0, 0), fmt.Errorf("%w: %T", ErrUnsupportedTimestampType, timestamp)
 	}
 }
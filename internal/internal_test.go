@@ -3,14 +3,25 @@ package internal
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/rand"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -34,6 +45,13 @@ var tests = []SnakeTest{
 	{"LinuxMOTD", "linux_motd"},
 	{"OMGWTFBBQ", "omgwtfbbq"},
 	{"omg_wtf_bbq", "omg_wtf_bbq"},
+	{"HTTPServer", "http_server"},
+	{"getHTTPResponseCode", "get_http_response_code"},
+	{"userID", "user_id"},
+	{"field2Name", "field2_name"},
+	{"Abc123Def", "abc123_def"},
+	{"abc123", "abc123"},
+	{"Snake_Test", "snake_test"},
 }
 
 func TestSnakeCase(t *testing.T) {
@@ -44,12 +62,92 @@ func TestSnakeCase(t *testing.T) {
 	}
 }
 
+func TestSanitizeMeasurementName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"postgresql", "postgresql"},
+		{"Query Stats", "query_stats"},
+		{"  leading and trailing  ", "leading_and_trailing"},
+		{"MixedCase", "mixedcase"},
+		{"db.table-name", "db_table_name"},
+		{"a__b..c", "a_b_c"},
+		{"tab\tnew\nline\x00", "tab_new_line"},
+		{"Größe Ü", "größe_ü"},
+		{"温度 2", "温度_2"},
+		{"...", ""},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, SanitizeMeasurementName(tt.input), tt.input)
+	}
+}
+
 var (
 	sleepbin, _ = exec.LookPath("sleep")
 	echobin, _  = exec.LookPath("echo")
 	shell, _    = exec.LookPath("sh")
 )
 
+func TestTruncateString(t *testing.T) {
+	tests := []struct {
+		s        string
+		max      int
+		marker   string
+		expected string
+	}{
+		{"server01", 10, "", "server01"},
+		{"server01", 8, "", "server01"},
+		{"server01", 6, "", "server"},
+		{"server01", 0, "", ""},
+		{"server01", -1, "", ""},
+		{"server01", 7, "...", "serv..."},
+		{"server01", 8, "...", "server01"},
+		{"server01", 3, "...", "ser"},
+		// "é" is 2 bytes, "日" 3 bytes and "🎮" 4 bytes
+		{"café", 4, "", "caf"},
+		{"café", 5, "", "café"},
+		{"日本語", 4, "", "日"},
+		{"日本語", 5, "", "日"},
+		{"日本語", 6, "", "日本"},
+		{"🎮🎮", 3, "", ""},
+		{"🎮🎮", 7, "", "🎮"},
+		{"日本語", 8, "…", "日…"},
+		{"日本語", 6, "…", "日…"},
+		{"日本語", 3, "…", "日"},
+		{"Etho🎮notch", 8, "..", "Etho.."},
+	}
+	for _, tt := range tests {
+		actual := TruncateStringMarker(tt.s, tt.max, tt.marker)
+		require.Equal(t, tt.expected, actual, "%q %d %q", tt.s, tt.max, tt.marker)
+		require.True(t, utf8.ValidString(actual), actual)
+		if tt.max >= 0 {
+			require.LessOrEqual(t, len(actual), tt.max)
+		}
+		if tt.marker == "" {
+			require.Equal(t, actual, TruncateString(tt.s, tt.max))
+		}
+	}
+}
+
+func TestFirstNonEmpty(t *testing.T) {
+	require.Equal(t, "", FirstNonEmpty())
+	require.Equal(t, "", FirstNonEmpty("", ""))
+	require.Equal(t, "postgresql", FirstNonEmpty("", "postgresql"))
+	require.Equal(t, "stats", FirstNonEmpty("", "stats", "postgresql"))
+	require.Equal(t, "custom", FirstNonEmpty("custom", "stats", "postgresql"))
+}
+
+func TestDedup(t *testing.T) {
+	in := []string{"datname", "usename", "datname", "state", "usename", "datname"}
+	require.Equal(t, []string{"datname", "usename", "state"}, Dedup(in))
+	require.Equal(t, []string{"datname", "usename", "datname", "state", "usename", "datname"}, in)
+
+	require.Equal(t, []string{"a", "b"}, Dedup([]string{"a", "b"}))
+	require.Equal(t, []string{}, Dedup([]string{}))
+	require.Nil(t, Dedup(nil))
+}
+
 func TestRunTimeout(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping test due to random failures.")
@@ -191,7 +289,44 @@ func TestDuration(t *testing.T) {
 
 	d = Duration{}
 	_ = d.UnmarshalTOML([]byte(`1.5`))
-	assert.Equal(t, time.Second, d.Duration)
+	assert.Equal(t, 1500*time.Millisecond, d.Duration)
+}
+
+func TestDurationFormats(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{`"1s"`, time.Second},
+		{`"500ms"`, 500 * time.Millisecond},
+		{`30`, 30 * time.Second},
+		{`1.5`, 1500 * time.Millisecond},
+		{`'2m'`, 2 * time.Minute},
+		{`""`, 0},
+		{`''`, 0},
+		{`"5h"`, 5 * time.Hour},
+		{`"7d"`, 7 * 24 * time.Hour},
+		{`"2w"`, 14 * 24 * time.Hour},
+		{`"1d12h"`, 36 * time.Hour},
+		{`"1w2d30m"`, 9*24*time.Hour + 30*time.Minute},
+		{`"1.5d"`, 36 * time.Hour},
+		{`"-1d"`, -24 * time.Hour},
+		{`7d`, 7 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		var d Duration
+		require.NoError(t, d.UnmarshalTOML([]byte(tt.input)), tt.input)
+		require.Equal(t, tt.expected, d.Duration, tt.input)
+	}
+}
+
+func TestDurationInvalid(t *testing.T) {
+	for _, input := range []string{`"banana"`, `banana`, `"10seconds"`, `"d"`, `"1dw"`, `"1.2.3d"`} {
+		var d Duration
+		err := d.UnmarshalTOML([]byte(input))
+		require.Error(t, err, input)
+		require.Contains(t, err.Error(), input)
+	}
 }
 
 func TestSize(t *testing.T) {
@@ -217,6 +352,62 @@ func TestSize(t *testing.T) {
 	assert.Equal(t, int64(12*1024*1024*1024), s.Size)
 }
 
+func TestSizeFractional(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`"1.5GB"`, 1500 * 1000 * 1000},
+		{`"512KiB"`, 512 * 1024},
+		{`"0.5KiB"`, 512},
+		{`"2.5MB"`, 2500 * 1000},
+		{`"1.0001KB"`, 1000},
+		{`0`, 0},
+		{`"0"`, 0},
+	}
+	for _, tt := range tests {
+		var s Size
+		require.NoError(t, s.UnmarshalTOML([]byte(tt.input)), tt.input)
+		require.Equal(t, tt.expected, s.Size, tt.input)
+	}
+}
+
+func TestSizeInvalid(t *testing.T) {
+	for _, input := range []string{`"-1MB"`, `-1`, `"-0.5GB"`, `"1.5XB"`, `"GB"`, `"1..5GB"`} {
+		var s Size
+		require.Error(t, s.UnmarshalTOML([]byte(input)), input)
+	}
+}
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{`3.14`, 3.14},
+		{`'3.14'`, 3.14},
+		{`"3.14"`, 3.14},
+		{`1000`, 1000},
+		{`"1,000"`, 1000},
+		{`-2.5`, -2.5},
+		{`"2k"`, 2000},
+		{`'1.5M'`, 1.5e6},
+		{`"3G"`, 3e9},
+	}
+	for _, tt := range tests {
+		var n Number
+		require.NoError(t, n.UnmarshalTOML([]byte(tt.input)), tt.input)
+		require.Equal(t, tt.expected, n.Value, tt.input)
+	}
+}
+
+func TestNumberInvalid(t *testing.T) {
+	for _, input := range []string{`abc`, `"abc"`, `"k"`, `"2x"`, `""`} {
+		var n Number
+		require.Error(t, n.UnmarshalTOML([]byte(input)), input)
+	}
+}
+
 func TestCompressWithGzip(t *testing.T) {
 	testData := "the quick brown fox jumps over the lazy dog"
 	inputBuffer := bytes.NewBuffer([]byte(testData))
@@ -234,12 +425,45 @@ func TestCompressWithGzip(t *testing.T) {
 	assert.Equal(t, testData, string(output))
 }
 
+func TestCompressWithGzipLevel(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&sb, "cpu,host=server%02d usage_idle=%d,usage_user=%d\n", i%50, i%97, i%13)
+	}
+	testData := sb.String()
+
+	compressedSize := func(level int) int {
+		rc, err := CompressWithGzipLevel(strings.NewReader(testData), level)
+		require.NoError(t, err)
+		defer rc.Close()
+		out, err := io.ReadAll(rc)
+		require.NoError(t, err)
+
+		gr, err := gzip.NewReader(bytes.NewReader(out))
+		require.NoError(t, err)
+		plain, err := io.ReadAll(gr)
+		require.NoError(t, err)
+		require.Equal(t, testData, string(plain))
+
+		return len(out)
+	}
+
+	require.Greater(t, compressedSize(gzip.BestSpeed), compressedSize(gzip.BestCompression))
+}
+
+func TestCompressWithGzipLevelInvalid(t *testing.T) {
+	for _, level := range []int{99, gzip.NoCompression, -5} {
+		_, err := CompressWithGzipLevel(strings.NewReader("data"), level)
+		require.Error(t, err, "level %d", level)
+	}
+}
+
 type mockReader struct {
-	readN uint64 // record the number of calls to Read
+	readN uint64 // record the number of calls to Read, accessed atomically
 }
 
 func (r *mockReader) Read(p []byte) (n int, err error) {
-	r.readN++
+	atomic.AddUint64(&r.readN, 1)
 	return rand.Read(p)
 }
 
@@ -253,19 +477,109 @@ func TestCompressWithGzipEarlyClose(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int64(10000), n)
 
-	r1 := mr.readN
 	err = rc.Close()
 	assert.NoError(t, err)
+	r1 := atomic.LoadUint64(&mr.readN)
 
 	n, err = io.CopyN(io.Discard, rc, 10000)
 	assert.Error(t, io.EOF, err)
 	assert.Equal(t, int64(0), n)
 
-	r2 := mr.readN
+	r2 := atomic.LoadUint64(&mr.readN)
 	// no more read to the source after closing
 	assert.Equal(t, r1, r2)
 }
 
+func TestCompressWithZstd(t *testing.T) {
+	testData := "the quick brown fox jumps over the lazy dog"
+	inputBuffer := bytes.NewBuffer([]byte(testData))
+
+	rc, err := CompressWithZstd(inputBuffer)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	zr, err := zstd.NewReader(rc)
+	require.NoError(t, err)
+	defer zr.Close()
+
+	output, err := io.ReadAll(zr)
+	require.NoError(t, err)
+
+	require.Equal(t, testData, string(output))
+}
+
+func TestCompressWithZstdEarlyClose(t *testing.T) {
+	mr := &mockReader{}
+
+	rc, err := CompressWithZstd(mr)
+	require.NoError(t, err)
+
+	n, err := io.CopyN(io.Discard, rc, 10000)
+	require.NoError(t, err)
+	require.Equal(t, int64(10000), n)
+
+	// Close waits for the compressor to stop reading from the source
+	require.NoError(t, rc.Close())
+	r1 := atomic.LoadUint64(&mr.readN)
+
+	n, err = io.CopyN(io.Discard, rc, 10000)
+	require.Error(t, err)
+	require.Equal(t, int64(0), n)
+
+	// no more read to the source after closing
+	require.Equal(t, r1, atomic.LoadUint64(&mr.readN))
+}
+
+type errReader struct {
+	data []byte
+	err  error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestCompressReaderError(t *testing.T) {
+	readErr := errors.New("source failed")
+	for _, algorithm := range []string{"gzip", "zstd"} {
+		algorithm := algorithm
+		t.Run(algorithm, func(t *testing.T) {
+			rc, err := Compress(&errReader{data: []byte("partial data"), err: readErr}, algorithm)
+			require.NoError(t, err)
+			defer rc.Close()
+
+			_, err = io.ReadAll(rc)
+			require.ErrorIs(t, err, readErr)
+		})
+	}
+}
+
+func TestCompress(t *testing.T) {
+	testData := "the quick brown fox jumps over the lazy dog"
+
+	rc, err := Compress(bytes.NewBufferString(testData), "none")
+	require.NoError(t, err)
+	output, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.Equal(t, testData, string(output))
+
+	rc, err = Compress(bytes.NewBufferString(testData), "gzip")
+	require.NoError(t, err)
+	gr, err := gzip.NewReader(rc)
+	require.NoError(t, err)
+	output, err = io.ReadAll(gr)
+	require.NoError(t, err)
+	require.Equal(t, testData, string(output))
+
+	_, err = Compress(bytes.NewBufferString(testData), "lzma")
+	require.Error(t, err)
+}
+
 func TestVersionAlreadySet(t *testing.T) {
 	err := SetVersion("foo")
 	assert.NoError(t, err)
@@ -278,6 +592,36 @@ func TestVersionAlreadySet(t *testing.T) {
 	assert.Equal(t, "foo", Version())
 }
 
+func TestRandomSleepContext(t *testing.T) {
+	require.NoError(t, RandomSleepContext(context.Background(), 0))
+	require.NoError(t, RandomSleepContext(context.Background(), time.Millisecond))
+}
+
+func TestRandomSleepContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	err := RandomSleepContext(ctx, time.Hour)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestRandomSleepShutdown(t *testing.T) {
+	shutdown := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(shutdown)
+	}()
+
+	start := time.Now()
+	RandomSleep(time.Hour, shutdown)
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
 func TestAlignDuration(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -366,6 +710,176 @@ func TestAlignTime(t *testing.T) {
 	}
 }
 
+func TestAlignNow(t *testing.T) {
+	now, err := time.Parse(time.RFC3339, "2018-01-01T01:01:01Z")
+	require.NoError(t, err)
+
+	defer func() { NowFunc = time.Now }()
+	NowFunc = func() time.Time { return now }
+
+	require.Equal(t, now.Add(9*time.Second), AlignTimeNow(10*time.Second))
+	require.Equal(t, 9*time.Second, AlignDurationNow(10*time.Second))
+	require.Equal(t, now.Add(59*time.Minute-time.Second), AlignTimeNow(time.Hour))
+
+	now = now.Add(9 * time.Second)
+	require.Equal(t, now, AlignTimeNow(10*time.Second))
+	require.Equal(t, time.Duration(0), AlignDurationNow(10*time.Second))
+}
+
+func TestContextWithInterval(t *testing.T) {
+	now, err := time.Parse(time.RFC3339Nano, "2018-01-01T01:01:01.5Z")
+	require.NoError(t, err)
+
+	defer func() { NowFunc = time.Now }()
+	NowFunc = func() time.Time { return now }
+
+	ctx, cancel := ContextWithInterval(context.Background(), 10*time.Second)
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	require.Equal(t, now.Add(8500*time.Millisecond), deadline)
+	cancel()
+	require.Error(t, ctx.Err())
+
+	// at a boundary the deadline is the following one
+	now = now.Add(8500 * time.Millisecond)
+	ctx, cancel = ContextWithInterval(context.Background(), 10*time.Second)
+	deadline, _ = ctx.Deadline()
+	require.Equal(t, now.Add(10*time.Second), deadline)
+	cancel()
+
+	// an earlier parent deadline is kept
+	parent, cancelParent := context.WithDeadline(context.Background(), now.Add(time.Second))
+	defer cancelParent()
+	ctx, cancel = ContextWithInterval(parent, time.Minute)
+	deadline, _ = ctx.Deadline()
+	require.Equal(t, now.Add(time.Second), deadline)
+	cancel()
+
+	ctx, cancel = ContextWithInterval(context.Background(), 0)
+	defer cancel()
+	_, ok = ctx.Deadline()
+	require.False(t, ok)
+}
+
+func TestAlignTimeWithOffset(t *testing.T) {
+	tests := []struct {
+		name     string
+		now      time.Time
+		interval time.Duration
+		offset   time.Duration
+		expected time.Time
+	}{
+		{
+			name:     "zero offset",
+			now:      time.Date(2018, 1, 1, 1, 1, 1, 0, time.UTC),
+			interval: time.Minute,
+			expected: time.Date(2018, 1, 1, 1, 2, 0, 0, time.UTC),
+		},
+		{
+			name:     "before offset",
+			now:      time.Date(2018, 1, 1, 1, 1, 1, 0, time.UTC),
+			interval: time.Minute,
+			offset:   15 * time.Second,
+			expected: time.Date(2018, 1, 1, 1, 1, 15, 0, time.UTC),
+		},
+		{
+			name:     "after offset",
+			now:      time.Date(2018, 1, 1, 1, 1, 20, 0, time.UTC),
+			interval: time.Minute,
+			offset:   15 * time.Second,
+			expected: time.Date(2018, 1, 1, 1, 2, 15, 0, time.UTC),
+		},
+		{
+			name:     "aligned on offset",
+			now:      time.Date(2018, 1, 1, 1, 1, 15, 0, time.UTC),
+			interval: time.Minute,
+			offset:   15 * time.Second,
+			expected: time.Date(2018, 1, 1, 1, 1, 15, 0, time.UTC),
+		},
+		{
+			name:     "offset wraps around interval",
+			now:      time.Date(2018, 1, 1, 1, 1, 1, 0, time.UTC),
+			interval: time.Minute,
+			offset:   2*time.Minute + 15*time.Second,
+			expected: time.Date(2018, 1, 1, 1, 1, 15, 0, time.UTC),
+		},
+		{
+			name:     "negative offset",
+			now:      time.Date(2018, 1, 1, 1, 1, 1, 0, time.UTC),
+			interval: time.Minute,
+			offset:   -15 * time.Second,
+			expected: time.Date(2018, 1, 1, 1, 1, 45, 0, time.UTC),
+		},
+		{
+			name:     "negative offset wraps around interval",
+			now:      time.Date(2018, 1, 1, 1, 1, 50, 0, time.UTC),
+			interval: time.Minute,
+			offset:   -75 * time.Second,
+			expected: time.Date(2018, 1, 1, 1, 2, 45, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, AlignTimeWithOffset(tt.now, tt.interval, tt.offset))
+			require.Equal(t, tt.expected.Sub(tt.now), AlignDurationWithOffset(tt.now, tt.interval, tt.offset))
+		})
+	}
+}
+
+func TestIntervalsIn(t *testing.T) {
+	tests := []struct {
+		name     string
+		d        time.Duration
+		interval time.Duration
+		expected int
+	}{
+		{
+			name:     "exact",
+			d:        time.Minute,
+			interval: 10 * time.Second,
+			expected: 6,
+		},
+		{
+			name:     "fractional rounds up",
+			d:        65 * time.Second,
+			interval: 10 * time.Second,
+			expected: 7,
+		},
+		{
+			name:     "shorter than interval",
+			d:        time.Second,
+			interval: 10 * time.Second,
+			expected: 1,
+		},
+		{
+			name:     "zero interval",
+			d:        time.Minute,
+			interval: 0,
+			expected: 0,
+		},
+		{
+			name:     "zero duration",
+			d:        0,
+			interval: 10 * time.Second,
+			expected: 0,
+		},
+		{
+			name:     "negative interval",
+			d:        time.Minute,
+			interval: -time.Second,
+			expected: 0,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, IntervalsIn(tt.d, tt.interval))
+		})
+	}
+}
+
 func TestParseTimestamp(t *testing.T) {
 	rfc3339 := func(value string) time.Time {
 		tm, err := time.Parse(time.RFC3339Nano, value)
@@ -452,10 +966,40 @@ func TestParseTimestamp(t *testing.T) {
 			expected:  rfc3339("2019-09-13T01:30:08.500Z"),
 		},
 		{
-			name:      "unix milliseconds with fractional is ignored",
+			name:      "unix seconds scientific notation",
+			format:    "unix",
+			timestamp: "1.6340256e9",
+			expected:  rfc3339("2021-10-12T08:00:00Z"),
+		},
+		{
+			name:      "unix seconds scientific notation without decimal point",
+			format:    "unix",
+			timestamp: "1e3",
+			expected:  rfc3339("1970-01-01T00:16:40Z"),
+		},
+		{
+			name:      "unix seconds malformed",
+			format:    "unix",
+			timestamp: "1.2.3",
+			err:       true,
+		},
+		{
+			name:      "unix seconds alias",
+			format:    "unix_s",
+			timestamp: "1568338208.500",
+			expected:  rfc3339("2019-09-13T01:30:08.500Z"),
+		},
+		{
+			name:      "unix milliseconds with fractional is an error",
 			format:    "unix_ms",
 			timestamp: "1568338208500.42",
-			expected:  rfc3339("2019-09-13T01:30:08.500Z"),
+			err:       true,
+		},
+		{
+			name:      "unix microseconds with comma fractional is an error",
+			format:    "unix_us",
+			timestamp: "1568338208000500,1",
+			err:       true,
 		},
 		{
 			name:      "unix microseconds",
@@ -469,6 +1013,43 @@ func TestParseTimestamp(t *testing.T) {
 			timestamp: "1568338208000000500",
 			expected:  rfc3339("2019-09-13T01:30:08.000000500Z"),
 		},
+		{
+			name:      "unix nanoseconds with fractional is an error",
+			format:    "unix_ns",
+			timestamp: "1568338208000000500.5",
+			err:       true,
+		},
+		{
+			name:      "rfc3339 with fractional seconds",
+			format:    "rfc3339",
+			timestamp: "2023-01-02T03:04:05.678Z",
+			expected:  rfc3339("2023-01-02T03:04:05.678Z"),
+		},
+		{
+			name:      "rfc3339 offset wins over location",
+			format:    "rfc3339",
+			timestamp: "2023-01-02T03:04:05+02:00",
+			location:  "America/New_York",
+			expected:  rfc3339("2023-01-02T03:04:05+02:00"),
+		},
+		{
+			name:      "rfc3339nano",
+			format:    "rfc3339nano",
+			timestamp: "2023-01-02T03:04:05.123456789-07:00",
+			expected:  rfc3339("2023-01-02T03:04:05.123456789-07:00"),
+		},
+		{
+			name:      "rfc3339 without offset is an error",
+			format:    "rfc3339",
+			timestamp: "2023-01-02T03:04:05",
+			err:       true,
+		},
+		{
+			name:      "rfc3339 requires a string",
+			format:    "rfc3339",
+			timestamp: int64(1568338208),
+			err:       true,
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
@@ -484,10 +1065,445 @@ func TestParseTimestamp(t *testing.T) {
 	}
 }
 
+func TestParseComponents(t *testing.T) {
+	integer, fractional, err := parseComponents("42.5", "")
+	require.NoError(t, err)
+	require.Equal(t, int64(42), integer)
+	require.Equal(t, int64(500000000), fractional)
+
+	_, _, err = parseComponents("1.2.3", "")
+	require.Error(t, err)
+}
+
+func TestParseTimestampTimePassthrough(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	tm := time.Date(2019, 9, 12, 21, 30, 8, 123456789, ny)
+
+	actual, err := ParseTimestamp("unix", tm, "")
+	require.NoError(t, err)
+	require.Equal(t, tm.UTC(), actual)
+	require.Equal(t, time.UTC, actual.Location())
+
+	actual, err = ParseTimestamp("unix_ms", &tm, "America/New_York")
+	require.NoError(t, err)
+	require.Equal(t, tm.UTC(), actual)
+
+	actual, err = ParseTimestamp("2006-01-02 15:04:05", tm, "Asia/Tokyo")
+	require.NoError(t, err)
+	require.True(t, tm.Equal(actual))
+	require.Equal(t, "Asia/Tokyo", actual.Location().String())
+
+	actual, err = ParseTimestamp("2006-01-02 15:04:05", &tm, "")
+	require.NoError(t, err)
+	require.Equal(t, tm.UTC(), actual)
+
+	actual, err = ParseTimestamp("rfc3339", tm, "Asia/Tokyo")
+	require.NoError(t, err)
+	require.Equal(t, tm, actual)
+
+	_, err = ParseTimestamp("unix", (*time.Time)(nil), "")
+	require.True(t, errors.Is(err, ErrUnsupportedTimestampType))
+
+	_, err = ParseTimestamp("2006-01-02", tm, "Nowhere/Invalid")
+	require.Error(t, err)
+}
+
+func TestParseTimestampUnixAuto(t *testing.T) {
+	expected := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		timestamp interface{}
+		expected  time.Time
+	}{
+		{"seconds", int64(1685577600), expected},
+		{"seconds string", "1685577600", expected},
+		{"seconds fractional", "1685577600.5", expected.Add(500 * time.Millisecond)},
+		{"seconds float", 1685577600.25, expected.Add(250 * time.Millisecond)},
+		{"seconds scientific", "1.6855776e9", expected},
+		{"milliseconds", int64(1685577600123), expected.Add(123 * time.Millisecond)},
+		{"milliseconds string", "1685577600123", expected.Add(123 * time.Millisecond)},
+		{"microseconds", int64(1685577600123456), expected.Add(123456 * time.Microsecond)},
+		{"nanoseconds", int64(1685577600123456789), expected.Add(123456789)},
+		{"nanoseconds string", "1685577600123456789", expected.Add(123456789)},
+		{"seconds boundary", int64(1e12), time.Unix(1e12, 0).UTC()},
+		{"milliseconds boundary", int64(1e12 + 1), time.Unix(0, (1e12+1)*1e6).UTC()},
+		{"microseconds boundary", int64(1e15 + 1), time.Unix(0, (1e15+1)*1e3).UTC()},
+		{"nanoseconds boundary", int64(1e18 + 1), time.Unix(0, 1e18+1).UTC()},
+		{"negative milliseconds", int64(-1685577600123), time.Unix(0, -1685577600123*1e6).UTC()},
+		{"large milliseconds", int64(1e15), time.Unix(1e12, 0).UTC()},
+		{"large microseconds", int64(1e18 - 1), time.Unix(1e12-1, 999999000).UTC()},
+		{"negative large milliseconds", int64(-1e13 - 5), time.Unix(-1e10, -5e6).UTC()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm, err := ParseTimestamp("unix_auto", tt.timestamp, "")
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, tm)
+		})
+	}
+
+	_, err := ParseTimestamp("unix_auto", "1685577600123.5", "")
+	require.True(t, errors.Is(err, ErrTimestampParse))
+
+	tm := time.Date(2023, 6, 1, 0, 0, 0, 0, time.FixedZone("CEST", 7200))
+	actual, err := ParseTimestamp("unix_auto", tm, "")
+	require.NoError(t, err)
+	require.Equal(t, tm.UTC(), actual)
+}
+
+func TestParseTimestampAny(t *testing.T) {
+	// time.Parse accepts fractional seconds not in the layout, so the
+	// layouts differ by their separators
+	formats := []string{"2006-01-02T15:04:05Z07:00", "2006-01-02 15:04:05"}
+	tests := []struct {
+		timestamp string
+		expected  time.Time
+	}{
+		{"2019-09-12T21:30:08Z", time.Date(2019, 9, 12, 21, 30, 8, 0, time.UTC)},
+		{"2019-09-12 21:30:08.125", time.Date(2019, 9, 12, 21, 30, 8, 125000000, time.UTC)},
+		{"2019-09-12T21:30:09.5Z", time.Date(2019, 9, 12, 21, 30, 9, 500000000, time.UTC)},
+		{"2019-09-12 21:30:09", time.Date(2019, 9, 12, 21, 30, 9, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		tm, err := ParseTimestampAny(formats, tt.timestamp, "")
+		require.NoError(t, err, tt.timestamp)
+		require.Equal(t, tt.expected, tm, tt.timestamp)
+	}
+
+	tm, err := ParseTimestampAny([]string{"rfc3339", "unix_ms"}, int64(1568323808125), "")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2019, 9, 12, 21, 30, 8, 125000000, time.UTC), tm)
+}
+
+func TestParseTimestampAnyErrors(t *testing.T) {
+	_, err := ParseTimestampAny([]string{"2006-01-02", "unix"}, "12/09/2019", "")
+	require.Error(t, err)
+	var errs MultiError
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 2)
+	require.True(t, errors.Is(err, ErrTimestampParse))
+	require.Contains(t, err.Error(), "2006-01-02: ")
+	require.Contains(t, err.Error(), "; unix: ")
+
+	_, err = ParseTimestampAny(nil, "2019-09-12", "")
+	require.Error(t, err)
+}
+
+func TestParseTimestampErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		timestamp interface{}
+		expected  error
+	}{
+		{
+			name:      "unix bool",
+			format:    "unix",
+			timestamp: true,
+			expected:  ErrUnsupportedTimestampType,
+		},
+		{
+			name:      "rfc3339 int",
+			format:    "rfc3339",
+			timestamp: int64(1568338208),
+			expected:  ErrUnsupportedTimestampType,
+		},
+		{
+			name:      "go format float",
+			format:    "2006-01-02",
+			timestamp: 1568338208.5,
+			expected:  ErrUnsupportedTimestampType,
+		},
+		{
+			name:      "unix garbage",
+			format:    "unix",
+			timestamp: "garbage",
+			expected:  ErrTimestampParse,
+		},
+		{
+			name:      "unix fractional garbage",
+			format:    "unix",
+			timestamp: "1568338208.x",
+			expected:  ErrTimestampParse,
+		},
+		{
+			name:      "unix_ms fractional",
+			format:    "unix_ms",
+			timestamp: "1568338208500.5",
+			expected:  ErrTimestampParse,
+		},
+		{
+			name:      "rfc3339 mismatch",
+			format:    "rfc3339",
+			timestamp: "2023-01-02",
+			expected:  ErrTimestampParse,
+		},
+		{
+			name:      "go format mismatch",
+			format:    "2006-01-02",
+			timestamp: "01/02/2023",
+			expected:  ErrTimestampParse,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTimestamp(tt.format, tt.timestamp, "")
+			require.Error(t, err)
+			require.True(t, errors.Is(err, tt.expected), err.Error())
+		})
+	}
+}
+
+func TestParseTimestampErrorCause(t *testing.T) {
+	_, err := ParseTimestamp("unix", "garbage", "")
+	require.True(t, errors.Is(err, ErrTimestampParse))
+	var numErr *strconv.NumError
+	require.True(t, errors.As(err, &numErr), err.Error())
+	require.Equal(t, "garbage", numErr.Num)
+	require.Equal(t, `timestamp parse error: parseint (garbage): strconv.ParseInt: parsing "garbage": invalid syntax`, err.Error())
+
+	_, err = ParseTimestamp("2006-01-02", "01/02/2023", "")
+	require.True(t, errors.Is(err, ErrTimestampParse))
+	var parseErr *time.ParseError
+	require.True(t, errors.As(err, &parseErr), err.Error())
+}
+
+func TestParseTimestampWithSeparator(t *testing.T) {
+	tests := []struct {
+		name      string
+		timestamp string
+		separator string
+		expected  time.Time
+		err       bool
+	}{
+		{
+			name:      "permissive comma decimal",
+			timestamp: "1234,5",
+			expected:  time.Unix(1234, 5e8).UTC(),
+		},
+		{
+			name:      "permissive thousands separator fails",
+			timestamp: "1,234.5",
+			err:       true,
+		},
+		{
+			name:      "european style",
+			timestamp: "1234,5",
+			separator: ",",
+			expected:  time.Unix(1234, 5e8).UTC(),
+		},
+		{
+			name:      "european style with thousands",
+			timestamp: "1.234,5",
+			separator: ",",
+			expected:  time.Unix(1234, 5e8).UTC(),
+		},
+		{
+			name:      "us style",
+			timestamp: "1,234.5",
+			separator: ".",
+			expected:  time.Unix(1234, 5e8).UTC(),
+		},
+		{
+			name:      "us style comma is not a decimal point",
+			timestamp: "1234,5",
+			separator: ".",
+			expected:  time.Unix(12345, 0).UTC(),
+		},
+		{
+			name:      "invalid separator",
+			timestamp: "1234;5",
+			separator: ";",
+			err:       true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tm, err := ParseTimestampWithSeparator("unix", tt.timestamp, "", tt.separator)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, tm)
+		})
+	}
+
+	tm, err := ParseTimestampWithSeparator("unix_ms", "1,568,338,208,500", "", ".")
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1568338208, 5e8).UTC(), tm)
+
+	_, err = ParseTimestampWithSeparator("unix_ms", "1568338208500,5", "", ",")
+	require.Error(t, err)
+}
+
+func writeLinesFile(t *testing.T, content string) string {
+	filename := filepath.Join(t.TempDir(), "lines")
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0600))
+	return filename
+}
+
+func TestReadLines(t *testing.T) {
+	lines, err := ReadLines(writeLinesFile(t, "one\ntwo\nthree\n"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"one", "two", "three"}, lines)
+}
+
+func TestReadLinesNoTrailingNewline(t *testing.T) {
+	filename := writeLinesFile(t, "one\ntwo\nthree")
+
+	lines, err := ReadLines(filename)
+	require.NoError(t, err)
+	require.Equal(t, []string{"one", "two", "three"}, lines)
+
+	lines, err = ReadLinesOffsetN(filename, 2, 5)
+	require.NoError(t, err)
+	require.Equal(t, []string{"three"}, lines)
+
+	lines, err = ReadLinesOffsetN(filename, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"two"}, lines)
+}
+
+func TestReadLinesEmpty(t *testing.T) {
+	lines, err := ReadLines(writeLinesFile(t, ""))
+	require.NoError(t, err)
+	require.Empty(t, lines)
+}
+
+func TestReadLinesBOM(t *testing.T) {
+	lines, err := ReadLines(writeLinesFile(t, "\xef\xbb\xbfone\ntwo\n"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"one", "two"}, lines)
+
+	lines, err = ReadLinesOffsetN(writeLinesFile(t, "\xef\xbb\xbfone\ntwo\n"), 1, -1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"two"}, lines)
+}
+
+func TestStripBOM(t *testing.T) {
+	require.Equal(t, []byte("abc"), StripBOM([]byte("\xef\xbb\xbfabc")))
+	require.Equal(t, []byte("abc"), StripBOM([]byte("abc")))
+	require.Equal(t, []byte("a\xef\xbb\xbf"), StripBOM([]byte("a\xef\xbb\xbf")))
+	require.Empty(t, StripBOM(nil))
+}
+
+func TestReadLinesReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		offset   uint
+		n        int
+		expected []string
+	}{
+		{
+			name:     "whole stream",
+			content:  "one\ntwo\nthree\n",
+			n:        -1,
+			expected: []string{"one", "two", "three"},
+		},
+		{
+			name:     "offset",
+			content:  "one\ntwo\nthree\n",
+			offset:   1,
+			n:        -1,
+			expected: []string{"two", "three"},
+		},
+		{
+			name:     "offset and count",
+			content:  "one\ntwo\nthree\nfour\n",
+			offset:   1,
+			n:        2,
+			expected: []string{"two", "three"},
+		},
+		{
+			name:    "zero count",
+			content: "one\ntwo\n",
+			n:       0,
+		},
+		{
+			name:    "offset past the end",
+			content: "one\ntwo\n",
+			offset:  5,
+			n:       -1,
+		},
+		{
+			name:     "no trailing newline",
+			content:  "one\ntwo",
+			n:        -1,
+			expected: []string{"one", "two"},
+		},
+		{
+			name:     "empty lines",
+			content:  "one\n\nthree\n",
+			n:        -1,
+			expected: []string{"one", "", "three"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := ReadLinesReader(strings.NewReader(tt.content), tt.offset, tt.n)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, lines)
+
+			// the file variant has the same behavior
+			lines, err = ReadLinesOffsetN(writeLinesFile(t, tt.content), tt.offset, tt.n)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, lines)
+		})
+	}
+}
+
+func TestReadLinesOpenError(t *testing.T) {
+	lines, err := ReadLinesOffsetN(filepath.Join(t.TempDir(), "missing"), 0, -1)
+	require.Error(t, err)
+	require.Nil(t, lines)
+}
+
+func TestRandomStringUnbiased(t *testing.T) {
+	require.Equal(t, "", RandomStringUnbiased(0))
+
+	s := RandomStringUnbiased(100)
+	require.Len(t, s, 100)
+	for _, c := range s {
+		require.True(t, strings.ContainsRune(alphanum, c), "unexpected character %q", c)
+	}
+}
+
+func TestRandomStringUnbiasedDistribution(t *testing.T) {
+	const perChar = 10000
+	counts := make(map[rune]int)
+	for _, c := range RandomStringUnbiased(perChar * len(alphanum)) {
+		counts[c]++
+	}
+
+	// The modulo mapping of RandomString over-represented the first 8
+	// characters by ~25%, a 5% band (~5 standard deviations) catches that.
+	for _, c := range alphanum {
+		require.InDelta(t, perChar, counts[c], perChar*0.05, "character %q", c)
+	}
+}
+
 func TestProductToken(t *testing.T) {
 	token := ProductToken()
 	// Agent version depends on the call to SetVersion, it cannot be set
 	// multiple times and is not thread-safe.
-	re := regexp.MustCompile(`^circonus-unified-agent/[^\s]+ Go/\d+.\d+(.\d+)?$`)
+	re := regexp.MustCompile(`^circonus-unified-agent/[^\s]* \(` + runtime.GOOS + `; ` + runtime.GOARCH + `\) Go/\d+.\d+(.\d+)?$`)
 	require.True(t, re.MatchString(token), token)
 }
+
+func TestProductTokenSuffix(t *testing.T) {
+	defer SetProductSuffix("")
+
+	SetProductSuffix("deploy-eu1")
+	token := ProductToken()
+	require.True(t, strings.HasPrefix(token, "circonus-unified-agent/"), token)
+	require.True(t, strings.HasSuffix(token, ") Go/"+strings.TrimPrefix(runtime.Version(), "go")+" deploy-eu1"), token)
+
+	SetProductSuffix("")
+	require.False(t, strings.HasSuffix(ProductToken(), " "))
+}
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrJSONPathNotFound is returned by JSONGet when a key or index of the path
+// is absent.
+var ErrJSONPathNotFound = fmt.Errorf("json path not found")
+
+// JSONGet returns the value found at path in the JSON document data. The path
+// is a dot separated list of object keys, each optionally followed by array
+// indices, ie, "a.b[0].c" or "[1].name" for a top level array. An empty path
+// returns the whole document.
+//
+// Objects are returned as map[string]interface{} and arrays as
+// []interface{}. Integral numbers are returned as int64 and other numbers as
+// float64, so that values can be passed to ParseTimestamp as is.
+func JSONGet(data []byte, path string) (interface{}, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("json decode: %w", err)
+	}
+
+	walked := ""
+	for _, step := range steps {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if step.key == "" {
+				return nil, fmt.Errorf("%s: object can't be indexed with [%d]", jsonPathName(walked), step.index)
+			}
+			child, ok := v[step.key]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s has no key %q", ErrJSONPathNotFound, jsonPathName(walked), step.key)
+			}
+			value = child
+		case []interface{}:
+			if step.key != "" {
+				return nil, fmt.Errorf("%s: array has no key %q", jsonPathName(walked), step.key)
+			}
+			if step.index >= len(v) {
+				return nil, fmt.Errorf("%w: %s index %d out of range, length %d", ErrJSONPathNotFound, jsonPathName(walked), step.index, len(v))
+			}
+			value = v[step.index]
+		default:
+			return nil, fmt.Errorf("%s: %s is not an object or array", jsonPathName(walked), jsonTypeName(value))
+		}
+		walked += step.String()
+	}
+
+	return jsonNumbers(value), nil
+}
+
+// jsonPathStep is either an object key or, when key is empty, an array index.
+type jsonPathStep struct {
+	key   string
+	index int
+}
+
+func (s jsonPathStep) String() string {
+	if s.key != "" {
+		return "." + s.key
+	}
+	return "[" + strconv.Itoa(s.index) + "]"
+}
+
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	var steps []jsonPathStep
+	if path == "" {
+		return steps, nil
+	}
+
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		if n := strings.IndexByte(part, '['); n >= 0 {
+			key, part = part[:n], part[n:]
+		} else {
+			part = ""
+		}
+		if key != "" {
+			steps = append(steps, jsonPathStep{key: key})
+		} else if part == "" {
+			return nil, fmt.Errorf("invalid json path %q: empty key", path)
+		}
+
+		for part != "" {
+			end := strings.IndexByte(part, ']')
+			if part[0] != '[' || end < 0 {
+				return nil, fmt.Errorf("invalid json path %q: malformed index", path)
+			}
+			index, err := strconv.Atoi(part[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid json path %q: bad index %q", path, part[1:end])
+			}
+			steps = append(steps, jsonPathStep{index: index})
+			part = part[end+1:]
+		}
+	}
+	return steps, nil
+}
+
+func jsonPathName(walked string) string {
+	if walked == "" {
+		return "document"
+	}
+	return strings.TrimPrefix(walked, ".")
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case json.Number:
+		return "number"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// jsonNumbers replaces the json.Numbers decoded in v by int64 or float64
+// values.
+func jsonNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = jsonNumbers(child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = jsonNumbers(child)
+		}
+		return v
+	default:
+		return v
+	}
+}
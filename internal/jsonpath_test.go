@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const jsonDoc = `{
+	"time": 1568338208500,
+	"host": {"name": "server01", "load": 0.25},
+	"disks": [
+		{"name": "sda", "parts": [{"used": 10}, {"used": 20}]},
+		{"name": "sdb", "parts": []}
+	],
+	"matrix": [[1, 2], [3, 4]],
+	"nothing": null
+}`
+
+func TestJSONGet(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected interface{}
+	}{
+		{"time", int64(1568338208500)},
+		{"host.name", "server01"},
+		{"host.load", 0.25},
+		{"host", map[string]interface{}{"name": "server01", "load": 0.25}},
+		{"disks[1].name", "sdb"},
+		{"disks[0].parts[1].used", int64(20)},
+		{"matrix[1][0]", int64(3)},
+		{"nothing", nil},
+	}
+	for _, tt := range tests {
+		actual, err := JSONGet([]byte(jsonDoc), tt.path)
+		require.NoError(t, err, tt.path)
+		require.Equal(t, tt.expected, actual, tt.path)
+	}
+}
+
+func TestJSONGetTopLevel(t *testing.T) {
+	v, err := JSONGet([]byte(`[{"a": "b"}]`), "[0].a")
+	require.NoError(t, err)
+	require.Equal(t, "b", v)
+
+	v, err = JSONGet([]byte(`42`), "")
+	require.NoError(t, err)
+	require.Equal(t, int64(42), v)
+}
+
+func TestJSONGetNotFound(t *testing.T) {
+	for _, path := range []string{"missing", "host.missing", "disks[2]", "disks[1].parts[0]"} {
+		_, err := JSONGet([]byte(jsonDoc), path)
+		require.Error(t, err, path)
+		require.True(t, errors.Is(err, ErrJSONPathNotFound), err.Error())
+	}
+}
+
+func TestJSONGetTypeMismatch(t *testing.T) {
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{"host.name.first", "host.name: string is not an object or array"},
+		{"host[0]", "host: object can't be indexed with [0]"},
+		{"disks.name", `disks: array has no key "name"`},
+		{"nothing.a", "nothing: null is not an object or array"},
+	}
+	for _, tt := range tests {
+		_, err := JSONGet([]byte(jsonDoc), tt.path)
+		require.EqualError(t, err, tt.err, tt.path)
+		require.False(t, errors.Is(err, ErrJSONPathNotFound), tt.path)
+	}
+}
+
+func TestJSONGetInvalid(t *testing.T) {
+	for _, path := range []string{"a..b", "a.", "a[x]", "a[-1]", "a[1", "a[1]b"} {
+		_, err := JSONGet([]byte(jsonDoc), path)
+		require.Error(t, err, path)
+	}
+
+	_, err := JSONGet([]byte(`{"a":`), "a")
+	require.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ParseKVString parses a key/value connection string, ie, a postgres DSN
+// like "host=localhost password='a secret'", into its options. Spaces are
+// allowed around the equal signs, values may be single quoted to contain
+// spaces and a backslash escapes the next character, quoted or not. A key
+// given twice keeps its last value.
+func ParseKVString(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	i := 0
+	skipSpaces := func() {
+		for i < len(s) && unicode.IsSpace(rune(s[i])) {
+			i++
+		}
+	}
+
+	for {
+		skipSpaces()
+		if i == len(s) {
+			return m, nil
+		}
+
+		start := i
+		for i < len(s) && s[i] != '=' && !unicode.IsSpace(rune(s[i])) {
+			i++
+		}
+		key := s[start:i]
+		skipSpaces()
+		if i == len(s) || s[i] != '=' {
+			return nil, fmt.Errorf("missing \"=\" after %q", key)
+		}
+		if key == "" {
+			return nil, fmt.Errorf("missing key at offset %d", i)
+		}
+		i++
+		skipSpaces()
+
+		var value strings.Builder
+		quoted := i < len(s) && s[i] == '\''
+		if quoted {
+			i++
+		}
+		closed := false
+		for i < len(s) {
+			c := s[i]
+			if c == '\\' && i+1 < len(s) {
+				value.WriteByte(s[i+1])
+				i += 2
+				continue
+			}
+			if quoted && c == '\'' {
+				closed = true
+				i++
+				break
+			}
+			if !quoted && unicode.IsSpace(rune(c)) {
+				break
+			}
+			value.WriteByte(c)
+			i++
+		}
+		if quoted && !closed {
+			return nil, fmt.Errorf("unterminated quoted value of %q", key)
+		}
+		m[key] = value.String()
+	}
+}
+
+// BuildKVString returns a key/value connection string of the options sorted
+// by key, quoting the values which are empty or contain spaces, quotes or
+// backslashes. ParseKVString returns the options back.
+func BuildKVString(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	escaper := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := m[k]
+		if v == "" || strings.ContainsAny(v, `'\`) || strings.IndexFunc(v, unicode.IsSpace) >= 0 {
+			v = "'" + escaper.Replace(v) + "'"
+		}
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKVString(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		expected map[string]string
+	}{
+		{
+			name:     "empty",
+			s:        "  ",
+			expected: map[string]string{},
+		},
+		{
+			name:     "plain",
+			s:        "host=localhost user=postgres sslmode=disable",
+			expected: map[string]string{"host": "localhost", "user": "postgres", "sslmode": "disable"},
+		},
+		{
+			name:     "spaces around equals",
+			s:        " host = localhost\tport= 5432 ",
+			expected: map[string]string{"host": "localhost", "port": "5432"},
+		},
+		{
+			name:     "quoted with spaces",
+			s:        "application_name='circonus agent' dbname=app",
+			expected: map[string]string{"application_name": "circonus agent", "dbname": "app"},
+		},
+		{
+			name:     "escaped quotes",
+			s:        `password='it\'s a \\ secret' user=o\'neil`,
+			expected: map[string]string{"password": `it's a \ secret`, "user": "o'neil"},
+		},
+		{
+			name:     "empty quoted value",
+			s:        "password='' host=db",
+			expected: map[string]string{"password": "", "host": "db"},
+		},
+		{
+			name:     "equals in value",
+			s:        "options='-c statement_timeout=5000' host=db",
+			expected: map[string]string{"options": "-c statement_timeout=5000", "host": "db"},
+		},
+		{
+			name:     "last wins",
+			s:        "host=a host=b",
+			expected: map[string]string{"host": "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseKVString(tt.s)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, m)
+		})
+	}
+}
+
+func TestParseKVStringInvalid(t *testing.T) {
+	for _, s := range []string{"host", "host localhost", "=localhost", "password='unterminated"} {
+		_, err := ParseKVString(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestBuildKVString(t *testing.T) {
+	m := map[string]string{
+		"host":             "localhost",
+		"password":         `it's a \ secret`,
+		"application_name": "circonus agent",
+		"sslpassword":      "",
+	}
+	s := BuildKVString(m)
+	require.Equal(t, `application_name='circonus agent' host=localhost password='it\'s a \\ secret' sslpassword=''`, s)
+
+	parsed, err := ParseKVString(s)
+	require.NoError(t, err)
+	require.Equal(t, m, parsed)
+}
+
+func TestKVStringRoundTrip(t *testing.T) {
+	dsn := `dbname=app host=db01 options='-c search_path=metrics' password='p@ss w\'rd' user=postgres`
+	m, err := ParseKVString(dsn)
+	require.NoError(t, err)
+	require.Equal(t, dsn, BuildKVString(m))
+}
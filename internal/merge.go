@@ -0,0 +1,90 @@
+package internal
+
+// MergeTOMLTrees performs a deep merge of two parsed TOML trees, returning a
+// new tree. Values in overlay take precedence over those in base; when both
+// sides hold a table the tables are merged recursively. Arrays and all other
+// values are replaced wholesale by the overlay. Neither input is modified.
+func MergeTOMLTrees(base, overlay map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(overlay))
+	for k, v := range base {
+		merged[k] = copyTOMLValue(v)
+	}
+
+	for k, v := range overlay {
+		overlayTable, ok := v.(map[string]interface{})
+		if !ok {
+			merged[k] = copyTOMLValue(v)
+			continue
+		}
+		if baseTable, ok := merged[k].(map[string]interface{}); ok {
+			merged[k] = MergeTOMLTrees(baseTable, overlayTable)
+			continue
+		}
+		merged[k] = copyTOMLValue(overlayTable)
+	}
+
+	return merged
+}
+
+// copyTOMLValue returns a deep copy of tables and arrays so the merged tree
+// does not share mutable state with its inputs.
+func copyTOMLValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return MergeTOMLTrees(val, nil)
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i := range val {
+			out[i] = copyTOMLValue(val[i])
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]map[string]interface{}, len(val))
+		for i := range val {
+			out[i] = MergeTOMLTrees(val[i], nil)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// CoalesceFields merges field maps from left to right keeping the first
+// non-nil value of each key, so partial results from several sources for the
+// same metric can be combined. Keys which are nil in every map are omitted.
+// None of the inputs are modified.
+func CoalesceFields(maps ...map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{})
+	for _, m := range maps {
+		for k, v := range m {
+			if v == nil {
+				continue
+			}
+			if _, ok := merged[k]; !ok {
+				merged[k] = v
+			}
+		}
+	}
+	return merged
+}
+
+// MergeTags merges tag maps from left to right, a later map overriding the
+// value of a tag set by an earlier one. Empty values are skipped so they
+// neither add a tag nor override one. A new map is always returned and none
+// of the inputs are modified, so shared default tags can be merged safely.
+func MergeTags(maps ...map[string]string) map[string]string {
+	n := 0
+	for _, m := range maps {
+		n += len(m)
+	}
+	merged := make(map[string]string, n)
+	for _, m := range maps {
+		for k, v := range m {
+			if v == "" {
+				continue
+			}
+			merged[k] = v
+		}
+	}
+	return merged
+}
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeTOMLTrees(t *testing.T) {
+	base := map[string]interface{}{
+		"interval": "10s",
+		"debug":    false,
+		"agent": map[string]interface{}{
+			"hostname": "base",
+			"tags": map[string]interface{}{
+				"dc":   "east",
+				"role": "db",
+			},
+		},
+		"servers": []interface{}{"a", "b"},
+	}
+	overlay := map[string]interface{}{
+		"debug": true,
+		"agent": map[string]interface{}{
+			"tags": map[string]interface{}{
+				"dc": "west",
+			},
+		},
+		"servers": []interface{}{"c"},
+		"extra":   int64(1),
+	}
+
+	expected := map[string]interface{}{
+		"interval": "10s",
+		"debug":    true,
+		"agent": map[string]interface{}{
+			"hostname": "base",
+			"tags": map[string]interface{}{
+				"dc":   "west",
+				"role": "db",
+			},
+		},
+		"servers": []interface{}{"c"},
+		"extra":   int64(1),
+	}
+
+	require.Equal(t, expected, MergeTOMLTrees(base, overlay))
+}
+
+func TestMergeTOMLTreesReplacesMismatchedTypes(t *testing.T) {
+	base := map[string]interface{}{
+		"outputs": map[string]interface{}{"file": "x"},
+		"servers": map[string]interface{}{"a": 1},
+	}
+	overlay := map[string]interface{}{
+		"outputs": "none",
+		"servers": []interface{}{"a"},
+	}
+
+	merged := MergeTOMLTrees(base, overlay)
+	require.Equal(t, "none", merged["outputs"])
+	require.Equal(t, []interface{}{"a"}, merged["servers"])
+}
+
+func TestMergeTOMLTreesDoesNotModifyInputs(t *testing.T) {
+	base := map[string]interface{}{
+		"agent": map[string]interface{}{"hostname": "base"},
+		"list":  []interface{}{"a"},
+	}
+	overlay := map[string]interface{}{
+		"agent": map[string]interface{}{"hostname": "overlay"},
+	}
+
+	merged := MergeTOMLTrees(base, overlay)
+	merged["agent"].(map[string]interface{})["hostname"] = "changed"
+	merged["list"].([]interface{})[0] = "changed"
+
+	require.Equal(t, "base", base["agent"].(map[string]interface{})["hostname"])
+	require.Equal(t, "overlay", overlay["agent"].(map[string]interface{})["hostname"])
+	require.Equal(t, "a", base["list"].([]interface{})[0])
+}
+
+func TestMergeTOMLTreesNil(t *testing.T) {
+	require.Equal(t, map[string]interface{}{}, MergeTOMLTrees(nil, nil))
+	require.Equal(t,
+		map[string]interface{}{"a": int64(1)},
+		MergeTOMLTrees(nil, map[string]interface{}{"a": int64(1)}))
+}
+
+func TestCoalesceFields(t *testing.T) {
+	proxy := map[string]interface{}{
+		"clients":     int64(4),
+		"total_reads": nil,
+		"cache_bytes": nil,
+	}
+	data := map[string]interface{}{
+		"clients":     int64(9),
+		"total_reads": int64(120),
+		"disk_bytes":  int64(2048),
+		"cache_bytes": nil,
+	}
+	extra := map[string]interface{}{
+		"total_reads": int64(1),
+		"uptime":      3.5,
+	}
+
+	merged := CoalesceFields(proxy, data, nil, extra)
+	require.Equal(t, map[string]interface{}{
+		"clients":     int64(4),
+		"total_reads": int64(120),
+		"disk_bytes":  int64(2048),
+		"uptime":      3.5,
+	}, merged)
+
+	// inputs are left untouched
+	require.Len(t, proxy, 3)
+	require.Nil(t, proxy["total_reads"])
+}
+
+func TestCoalesceFieldsEmpty(t *testing.T) {
+	require.Empty(t, CoalesceFields())
+	require.Empty(t, CoalesceFields(map[string]interface{}{"a": nil}))
+}
+
+func TestMergeTags(t *testing.T) {
+	defaults := map[string]string{
+		"rethinkdb_host":     "127.0.0.1:28015",
+		"rethinkdb_hostname": "rethink01",
+		"type":               "member",
+	}
+	merged := MergeTags(defaults, nil, map[string]string{"type": "data", "ns": "test.users"})
+	require.Equal(t, map[string]string{
+		"rethinkdb_host":     "127.0.0.1:28015",
+		"rethinkdb_hostname": "rethink01",
+		"type":               "data",
+		"ns":                 "test.users",
+	}, merged)
+
+	// inputs are left untouched
+	require.Len(t, defaults, 3)
+	require.Equal(t, "member", defaults["type"])
+}
+
+func TestMergeTagsSkipsEmpty(t *testing.T) {
+	merged := MergeTags(
+		map[string]string{"server": "db01", "db": ""},
+		map[string]string{"server": "", "state": "active"},
+	)
+	require.Equal(t, map[string]string{"server": "db01", "state": "active"}, merged)
+
+	require.Empty(t, MergeTags())
+	require.NotNil(t, MergeTags())
+}
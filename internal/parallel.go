@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// MultiError holds the errors of several operations, in no particular
+// order.
+type MultiError []error
+
+func (m MultiError) Error() string {
+	msgs := make([]string, 0, len(m))
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the errors matches target.
+func (m MultiError) Is(target error) bool {
+	for _, err := range m {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParallelDo calls fn for each index in [0, n) using at most concurrency
+// goroutines, a concurrency below 1 runs every call at once. No more calls
+// are started once the context is done. The errors returned by fn, and the
+// context error when calls were skipped, are returned as a MultiError, nil
+// is returned when every call succeeded.
+func ParallelDo(ctx context.Context, concurrency, n int, fn func(ctx context.Context, i int) error) error {
+	if concurrency < 1 || concurrency > n {
+		concurrency = n
+	}
+
+	var (
+		mu      sync.Mutex
+		errs    MultiError
+		skipped error
+		wg      sync.WaitGroup
+	)
+	indexes := make(chan int)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				// an index may be received after the context is done
+				if err := ctx.Err(); err != nil {
+					mu.Lock()
+					skipped = err
+					mu.Unlock()
+					continue
+				}
+				if err := fn(ctx, i); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	sent := 0
+dispatch:
+	for ; sent < n; sent++ {
+		select {
+		case indexes <- sent:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if skipped == nil && sent < n {
+		skipped = ctx.Err()
+	}
+	if skipped != nil {
+		errs = append(errs, skipped)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelDoBounded(t *testing.T) {
+	var running, peak int32
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+
+	err := ParallelDo(context.Background(), 3, 20, func(ctx context.Context, i int) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		seen[i] = true
+		mu.Unlock()
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, seen, 20)
+	require.LessOrEqual(t, atomic.LoadInt32(&peak), int32(3))
+	require.Greater(t, atomic.LoadInt32(&peak), int32(1))
+}
+
+func TestParallelDoErrors(t *testing.T) {
+	errOdd := errors.New("odd")
+	err := ParallelDo(context.Background(), 2, 6, func(ctx context.Context, i int) error {
+		if i%2 == 1 {
+			return fmt.Errorf("item %d: %w", i, errOdd)
+		}
+		return nil
+	})
+	require.Error(t, err)
+
+	var multi MultiError
+	require.True(t, errors.As(err, &multi))
+	require.Len(t, multi, 3)
+	require.True(t, errors.Is(err, errOdd))
+	require.Contains(t, err.Error(), "item 3: odd")
+}
+
+func TestParallelDoCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int32
+
+	err := ParallelDo(ctx, 1, 100, func(ctx context.Context, i int) error {
+		if atomic.AddInt32(&calls, 1) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	require.True(t, errors.Is(err, context.Canceled))
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestParallelDoEmpty(t *testing.T) {
+	require.NoError(t, ParallelDo(context.Background(), 4, 0, func(ctx context.Context, i int) error {
+		return errors.New("not called")
+	}))
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Renamer renames field (or tag) names according to a set of rules.
+type Renamer struct {
+	literal map[string]string
+	globs   []renameGlob
+}
+
+type renameGlob struct {
+	re       *regexp.Regexp
+	template string
+}
+
+// NewRenamer builds a Renamer from a map of source name to new name. Source
+// names may be globs where "*" matches any run of characters and "?" matches
+// a single character. Each wildcard is captured in order and can be referenced
+// in the new name as $1, $2, etc, ie:
+//
+//	r := NewRenamer(map[string]string{"blks_*": "blocks_$1"})
+//	r.Rename("blks_hit") // "blocks_hit"
+//
+// Literal rules take precedence over globs, and longer globs are tried before
+// shorter ones so that the most specific pattern wins.
+func NewRenamer(rules map[string]string) *Renamer {
+	r := &Renamer{literal: make(map[string]string)}
+
+	patterns := make([]string, 0, len(rules))
+	for from, to := range rules {
+		if !strings.ContainsAny(from, "*?") {
+			r.literal[from] = to
+			continue
+		}
+		patterns = append(patterns, from)
+	}
+
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	for _, pattern := range patterns {
+		r.globs = append(r.globs, renameGlob{
+			re:       globToRegexp(pattern),
+			template: captureRef.ReplaceAllString(rules[pattern], "$${$1}"),
+		})
+	}
+
+	return r
+}
+
+// Rename returns the new name for name, or name unchanged when no rule
+// matches.
+func (r *Renamer) Rename(name string) string {
+	if to, ok := r.literal[name]; ok {
+		return to
+	}
+	for _, g := range r.globs {
+		match := g.re.FindStringSubmatchIndex(name)
+		if match == nil {
+			continue
+		}
+		return string(g.re.ExpandString(nil, g.template, name, match))
+	}
+	return name
+}
+
+// captureRef matches numbered references such as $1 so they can be rewritten
+// as ${1}, otherwise "$1_x" would refer to a group named "1_x".
+var captureRef = regexp.MustCompile(`\$(\d+)`)
+
+// globToRegexp converts a glob using "*" and "?" wildcards into an anchored
+// regexp with a capture group for each wildcard.
+func globToRegexp(glob string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, c := range glob {
+		switch c {
+		case '*':
+			sb.WriteString("(.*)")
+		case '?':
+			sb.WriteString("(.)")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
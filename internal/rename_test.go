@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenamer(t *testing.T) {
+	r := NewRenamer(map[string]string{
+		"xact_commit":    "commits",
+		"blks_*":         "blocks_$1",
+		"tup_*_total":    "tuples_${1}",
+		"disk_?_*":       "disk$1_$2",
+		"*":              "should_not_match_literal",
+		"blks_read_time": "block_read_ms",
+	})
+
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"xact_commit", "commits"},
+		{"blks_hit", "blocks_hit"},
+		{"blks_read_time", "block_read_ms"},
+		{"tup_fetched_total", "tuples_fetched"},
+		{"disk_a_reads", "diska_reads"},
+		{"other", "should_not_match_literal"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, r.Rename(tt.in), tt.in)
+	}
+}
+
+func TestRenamerNoMatch(t *testing.T) {
+	r := NewRenamer(map[string]string{
+		"blks_*": "blocks_$1",
+		"a.b":    "ab",
+	})
+
+	require.Equal(t, "xact_commit", r.Rename("xact_commit"))
+	// glob metacharacters are only * and ?, a dot is literal
+	require.Equal(t, "axb", r.Rename("axb"))
+	require.Equal(t, "ab", r.Rename("a.b"))
+}
+
+func TestRenamerEmpty(t *testing.T) {
+	r := NewRenamer(nil)
+	require.Equal(t, "field", r.Rename("field"))
+}
@@ -0,0 +1,20 @@
+//go:build !purego
+// +build !purego
+
+package internal
+
+import "unsafe"
+
+// UnsafeString returns the bytes of b as a string without copying them.
+//
+// The string shares its memory with b: b must not be modified for as long as
+// the string, or any string derived from it, is in use, which includes
+// storing it in a map, a tag or a field. Use it only for short lived read
+// only conversions, ie, comparing a column value against a set of names.
+// Building with the purego tag replaces it by a copying conversion.
+func UnsafeString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return *(*string)(unsafe.Pointer(&b))
+}
@@ -0,0 +1,11 @@
+//go:build purego
+// +build purego
+
+package internal
+
+// UnsafeString returns the bytes of b as a string. This is the copying
+// fallback used when building with the purego tag, see the default build for
+// the restrictions callers must follow.
+func UnsafeString(b []byte) string {
+	return string(b)
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnsafeString(t *testing.T) {
+	require.Equal(t, "", UnsafeString(nil))
+	require.Equal(t, "", UnsafeString([]byte{}))
+	require.Equal(t, "pg_stat_database", UnsafeString([]byte("pg_stat_database")))
+
+	b := []byte("datname\x00")
+	require.Equal(t, "datname", UnsafeString(b[:7]))
+}
+
+var benchmarkColumn = []byte("pg_stat_bgwriter_buffers_checkpoint")
+
+func BenchmarkUnsafeString(b *testing.B) {
+	b.ReportAllocs()
+	n := 0
+	for i := 0; i < b.N; i++ {
+		if UnsafeString(benchmarkColumn) == "datname" {
+			n++
+		}
+	}
+	_ = n
+}
+
+func BenchmarkStringConversion(b *testing.B) {
+	b.ReportAllocs()
+	var s string
+	for i := 0; i < b.N; i++ {
+		s = string(benchmarkColumn)
+	}
+	_ = s
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// ValidateFields returns the fields whose values are of a type supported by
+// the accumulator (integers, unsigned integers, floats, strings and bools)
+// along with a description of each dropped field, ie, "key: unsupported type
+// []uint8", sorted by key. NaN and infinite floats are dropped as they can't
+// be serialized. The input is not modified.
+func ValidateFields(fields map[string]interface{}) (map[string]interface{}, []string) {
+	valid := make(map[string]interface{}, len(fields))
+	var dropped []string
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if reason := fieldValueError(fields[k]); reason != "" {
+			dropped = append(dropped, k+": "+reason)
+			continue
+		}
+		valid[k] = fields[k]
+	}
+	return valid, dropped
+}
+
+// fieldValueError returns why v can't be used as a field value, or an empty
+// string if it can.
+func fieldValueError(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "nil value"
+	case int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		string, bool:
+		return ""
+	case float32:
+		return floatValueError(float64(val))
+	case float64:
+		return floatValueError(val)
+	default:
+		return fmt.Sprintf("unsupported type %T", v)
+	}
+}
+
+func floatValueError(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN value"
+	case math.IsInf(f, 0):
+		return "infinite value"
+	default:
+		return ""
+	}
+}
+
+// ClampDuration returns d bounded to the range [min, max], a max of zero or
+// less leaves the duration unbounded above. Plugins use it to keep
+// configured intervals within sane limits, ie, a 1ns poll interval.
+func ClampDuration(d, min, max time.Duration) time.Duration {
+	if max > 0 && d > max {
+		d = max
+	}
+	if d < min {
+		d = min
+	}
+	return d
+}
+
+// ValidateDuration returns an error naming the option when the duration is
+// negative, or zero and allowZero is false, for use in plugin Init methods.
+func ValidateDuration(option string, d time.Duration, allowZero bool) error {
+	switch {
+	case d < 0:
+		return fmt.Errorf("%s must not be negative, got %s", option, d)
+	case d == 0 && !allowZero:
+		return fmt.Errorf("%s must be greater than zero", option)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateFields(t *testing.T) {
+	fields := map[string]interface{}{
+		"int":     42,
+		"int64":   int64(-7),
+		"uint8":   uint8(1),
+		"uint64":  uint64(1 << 63),
+		"float32": float32(0.5),
+		"float64": 1.5,
+		"string":  "up",
+		"bool":    true,
+	}
+
+	valid, dropped := ValidateFields(fields)
+	require.Equal(t, fields, valid)
+	require.Empty(t, dropped)
+}
+
+func TestValidateFieldsInvalid(t *testing.T) {
+	fields := map[string]interface{}{
+		"ok":       int64(1),
+		"bytes":    []byte("raw"),
+		"time":     time.Unix(0, 0),
+		"nil":      nil,
+		"nan":      math.NaN(),
+		"inf":      math.Inf(-1),
+		"map":      map[string]interface{}{"a": 1},
+		"ratio":    float32(0.25),
+		"pointer":  new(int64),
+		"disabled": false,
+	}
+
+	valid, dropped := ValidateFields(fields)
+	require.Equal(t, map[string]interface{}{
+		"ok":       int64(1),
+		"ratio":    float32(0.25),
+		"disabled": false,
+	}, valid)
+	require.Equal(t, []string{
+		"bytes: unsupported type []uint8",
+		"inf: infinite value",
+		"map: unsupported type map[string]interface {}",
+		"nan: NaN value",
+		"nil: nil value",
+		"pointer: unsupported type *int64",
+		"time: unsupported type time.Time",
+	}, dropped)
+
+	// the input is left untouched
+	require.Len(t, fields, 10)
+}
+
+func TestClampDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		d        time.Duration
+		min      time.Duration
+		max      time.Duration
+		expected time.Duration
+	}{
+		{"in range", 10 * time.Second, time.Second, time.Minute, 10 * time.Second},
+		{"at min", time.Second, time.Second, time.Minute, time.Second},
+		{"at max", time.Minute, time.Second, time.Minute, time.Minute},
+		{"below min", time.Nanosecond, time.Second, time.Minute, time.Second},
+		{"negative", -5 * time.Second, 0, time.Minute, 0},
+		{"above max", time.Hour, time.Second, time.Minute, time.Minute},
+		{"unbounded max", 24 * time.Hour, time.Second, 0, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, ClampDuration(tt.d, tt.min, tt.max))
+		})
+	}
+}
+
+func TestValidateDuration(t *testing.T) {
+	require.NoError(t, ValidateDuration("timeout", time.Second, false))
+	require.NoError(t, ValidateDuration("timeout", 0, true))
+	require.EqualError(t, ValidateDuration("timeout", 0, false), "timeout must be greater than zero")
+	require.EqualError(t, ValidateDuration("timeout", -time.Second, true), "timeout must not be negative, got -1s")
+}
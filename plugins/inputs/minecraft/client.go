@@ -1,23 +1,31 @@
 package minecraft
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/circonus-labs/circonus-unified-agent/plugins/inputs/minecraft/internal/rcon"
 )
 
 var (
-	scoreboardRegexLegacy = regexp.MustCompile(`(?U):\s(?P<value>\d+)\s\((?P<name>.*)\)`)
-	scoreboardRegex       = regexp.MustCompile(`\[(?P<name>[^\]]+)\]: (?P<value>\d+)`)
+	scoreboardRegexLegacy = regexp.MustCompile(`(?U):\s(?P<value>-?\d+)\s\((?P<name>.*)\)`)
+	scoreboardRegex       = regexp.MustCompile(`\[(?P<name>[^\]]+)\]: (?P<value>-?\d+)`)
+	maxPlayersRegex       = regexp.MustCompile(`(?:/| a max of | out of maximum )(\d+) players online`)
+
+	errClientClosed = errors.New("client closed")
 )
 
 // Connection is an established connection to the Minecraft server.
 type Connection interface {
 	// Execute runs a command.
 	Execute(command string) (string, error)
+
+	// Close closes the connection.
+	Close() error
 }
 
 // Connector is used to create connections to the Minecraft server.
@@ -53,6 +61,7 @@ func (c *connector) Connect() (Connection, error) {
 
 	_, err = rcon.Authorize(c.password)
 	if err != nil {
+		rcon.Connection.Close()
 		return nil, fmt.Errorf("rcon auth: %w", err)
 	}
 
@@ -65,54 +74,108 @@ func newClient(connector Connector) *client {
 
 type client struct {
 	connector Connector
-	conn      Connection
+
+	// mu guards the connection, which Close drops while a command may be
+	// running on it
+	mu     sync.Mutex
+	conn   Connection
+	closed bool
 }
 
 func (c *client) Connect() error {
+	_, err := c.connect()
+	return err
+}
+
+func (c *client) connect() (Connection, error) {
 	conn, err := c.connector.Connect()
 	if err != nil {
-		return fmt.Errorf("connect: %w", err)
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		conn.Close()
+		return nil, errClientClosed
 	}
 	c.conn = conn
-	return nil
+	return conn, nil
 }
 
-func (c *client) Players() ([]string, error) {
-	if c.conn == nil {
-		err := c.Connect()
-		if err != nil {
-			return nil, err
+// Close closes the connection, a command blocked on it returns an error.
+func (c *client) Close() error {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.closed = true
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+// execute runs a command, connecting first when needed. The connection is
+// closed when the command fails so the next command connects again.
+func (c *client) execute(command string) (string, error) {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		var err error
+		if conn, err = c.connect(); err != nil {
+			return "", err
 		}
 	}
 
-	resp, err := c.conn.Execute("scoreboard players list")
+	resp, err := conn.Execute(command)
 	if err != nil {
-		c.conn = nil
-		return nil, fmt.Errorf("conn execute: %w", err)
+		c.mu.Lock()
+		if c.conn == conn {
+			c.conn = nil
+		}
+		c.mu.Unlock()
+		conn.Close()
+		return "", fmt.Errorf("conn execute: %w", err)
 	}
+	return resp, nil
+}
 
-	players := parsePlayers(resp)
-
-	return players, nil
+func (c *client) Players() ([]string, error) {
+	resp, err := c.execute("scoreboard players list")
+	if err != nil {
+		return nil, err
+	}
+	return parsePlayers(resp), nil
 }
 
 func (c *client) Scores(player string) ([]Score, error) {
-	if c.conn == nil {
-		err := c.Connect()
-		if err != nil {
-			return nil, err
-		}
+	resp, err := c.execute("scoreboard players list " + player)
+	if err != nil {
+		return nil, err
 	}
+	return parseScores(resp), nil
+}
 
-	resp, err := c.conn.Execute("scoreboard players list " + player)
+func (c *client) Online() ([]string, error) {
+	resp, err := c.execute("list")
 	if err != nil {
-		c.conn = nil
-		return nil, fmt.Errorf("conn execute: %w", err)
+		return nil, err
 	}
+	return parseOnline(resp), nil
+}
 
-	scores := parseScores(resp)
-
-	return scores, nil
+// OnlineInfo returns the online players and the capacity of the server from
+// a single list command, the version and MOTD are not available over RCON.
+func (c *client) OnlineInfo() ([]string, *ServerInfo, error) {
+	resp, err := c.execute("list")
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseOnline(resp), &ServerInfo{MaxPlayers: parseMaxPlayers(resp)}, nil
 }
 
 type connection struct {
@@ -127,6 +190,10 @@ func (c *connection) Execute(command string) (string, error) {
 	return packet.Body, nil
 }
 
+func (c *connection) Close() error {
+	return c.rcon.Connection.Close()
+}
+
 func parsePlayers(input string) []string {
 	parts := strings.SplitAfterN(input, ":", 2)
 	if len(parts) != 2 {
@@ -156,6 +223,40 @@ func parsePlayers(input string) []string {
 	return players
 }
 
+// parseOnline parses the response of the list command, e.g. "There are 2 of
+// a max of 20 players online: Etho, notch".
+func parseOnline(input string) []string {
+	parts := strings.SplitN(input, ":", 2)
+	if len(parts) != 2 {
+		return []string{}
+	}
+
+	names := strings.Split(parts[1], ",")
+	players := make([]string, 0, len(names))
+	for _, name := range names {
+		name := strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		players = append(players, name)
+	}
+	return players
+}
+
+// parseMaxPlayers parses the capacity of the server from the response of the
+// list command, 0 when the response doesn't include it.
+func parseMaxPlayers(input string) int64 {
+	match := maxPlayersRegex.FindStringSubmatch(input)
+	if match == nil {
+		return 0
+	}
+	maxPlayers, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return maxPlayers
+}
+
 // Score is an individual tracked scoreboard stat.
 type Score struct {
 	Name  string
@@ -179,13 +280,17 @@ func parseScores(input string) []Score {
 	matches := re.FindAllStringSubmatch(input, -1)
 	for _, match := range matches {
 		score := Score{}
+		valid := true
 		for i, subexp := range re.SubexpNames() {
 			switch subexp {
 			case "name":
 				score.Name = match[i]
 			case "value":
+				// scores are integers, possibly negative, a value out of
+				// range is skipped rather than reported as 0
 				value, err := strconv.ParseInt(match[i], 10, 64)
 				if err != nil {
+					valid = false
 					continue
 				}
 				score.Value = value
@@ -193,7 +298,9 @@ func parseScores(input string) []Score {
 				continue
 			}
 		}
-		scores = append(scores, score)
+		if valid {
+			scores = append(scores, score)
+		}
 	}
 	return scores
 }
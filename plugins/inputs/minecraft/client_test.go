@@ -8,12 +8,20 @@ import (
 
 type MockConnection struct {
 	commands map[string]string
+	executed []string
+	closed   bool
 }
 
 func (c *MockConnection) Execute(command string) (string, error) {
+	c.executed = append(c.executed, command)
 	return c.commands[command], nil
 }
 
+func (c *MockConnection) Close() error {
+	c.closed = true
+	return nil
+}
+
 type MockConnector struct {
 	conn *MockConnection
 }
@@ -175,6 +183,38 @@ func TestClient_Scores(t *testing.T) {
 				{Name: "redstone", Value: 1},
 			},
 		},
+		{
+			name:   "minecraft 1.12 player with negative score",
+			player: "Etho",
+			commands: map[string]string{
+				"scoreboard players list Etho": "Showing 2 tracked objective(s) for Etho:- balance: -15 (balance)- jump: 2 (jump)",
+			},
+			expected: []Score{
+				{Name: "balance", Value: -15},
+				{Name: "jump", Value: 2},
+			},
+		},
+		{
+			name:   "minecraft 1.13 player with negative score",
+			player: "Etho",
+			commands: map[string]string{
+				"scoreboard players list Etho": "Etho has 2 scores:[balance]: -15[jumps]: 1",
+			},
+			expected: []Score{
+				{Name: "balance", Value: -15},
+				{Name: "jumps", Value: 1},
+			},
+		},
+		{
+			name:   "minecraft 1.13 player with score out of range",
+			player: "Etho",
+			commands: map[string]string{
+				"scoreboard players list Etho": "Etho has 2 scores:[huge]: 99999999999999999999[jumps]: 1",
+			},
+			expected: []Score{
+				{Name: "jumps", Value: 1},
+			},
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
@@ -191,3 +231,107 @@ func TestClient_Scores(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_Online(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		expected []string
+	}{
+		{
+			name:     "minecraft 1.12 no players",
+			response: "There are 0/20 players online:",
+			expected: []string{},
+		},
+		{
+			name:     "minecraft 1.12 players",
+			response: "There are 2/20 players online:Etho, notch",
+			expected: []string{"Etho", "notch"},
+		},
+		{
+			name:     "minecraft 1.13 no players",
+			response: "There are 0 of a max of 20 players online: ",
+			expected: []string{},
+		},
+		{
+			name:     "minecraft 1.13 players",
+			response: "There are 3 of a max of 20 players online: Etho, notch, jeb",
+			expected: []string{"Etho", "notch", "jeb"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			connector := &MockConnector{
+				conn: &MockConnection{commands: map[string]string{"list": tt.response}},
+			}
+
+			client := newClient(connector)
+			actual, err := client.Online()
+			require.NoError(t, err)
+
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestClient_OnlineInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		online   []string
+		expected int64
+	}{
+		{
+			name:     "minecraft 1.12",
+			response: "There are 2/20 players online:Etho, notch",
+			online:   []string{"Etho", "notch"},
+			expected: 20,
+		},
+		{
+			name:     "minecraft 1.13",
+			response: "There are 0 of a max of 100 players online: ",
+			online:   []string{},
+			expected: 100,
+		},
+		{
+			name:     "paper",
+			response: "There are 1 out of maximum 50 players online.\ndefault: Etho",
+			online:   []string{"Etho"},
+			expected: 50,
+		},
+		{
+			name:     "unknown capacity",
+			response: "Players online: Etho",
+			online:   []string{"Etho"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &MockConnection{commands: map[string]string{"list": tt.response}}
+
+			client := newClient(&MockConnector{conn: conn})
+			online, info, err := client.OnlineInfo()
+			require.NoError(t, err)
+			require.Equal(t, tt.online, online)
+			require.Equal(t, &ServerInfo{MaxPlayers: tt.expected}, info)
+			require.Equal(t, []string{"list"}, conn.executed)
+		})
+	}
+}
+
+func TestClient_Close(t *testing.T) {
+	conn := &MockConnection{commands: map[string]string{"list": "There are 0 of a max of 20 players online: "}}
+	client := newClient(&MockConnector{conn: conn})
+
+	_, err := client.Online()
+	require.NoError(t, err)
+
+	require.NoError(t, client.Close())
+	require.True(t, conn.closed)
+
+	// a closed client doesn't connect again
+	_, err = client.Online()
+	require.ErrorIs(t, err, errClientClosed)
+}
@@ -3,8 +3,12 @@ package minecraft
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/filter"
+	"github.com/circonus-labs/circonus-unified-agent/internal"
 	"github.com/circonus-labs/circonus-unified-agent/plugins/inputs"
 )
 
@@ -14,12 +18,56 @@ const sampleConfig = `
   ## Address of the Minecraft server.
   # server = "localhost"
 
-  ## Server RCON Port.
+  ## Protocol used to gather the server, either "rcon" or "query". The query
+  ## protocol needs enable-query in server.properties and no password, but
+  ## only reports the online players as it has no access to the scoreboard.
+  # protocol = "rcon"
+
+  ## Server RCON Port, or query port when using the query protocol.
+  ## Defaults to 25575 for rcon and 25565 for query.
   # port = "25575"
 
   ## Server RCON Password.
   password = ""
 
+  ## Additional servers to gather, the server, port and password options
+  ## above are ignored when unset and servers are listed here.
+  # [[inputs.minecraft.servers]]
+  #   server = "mc1.example.org"
+  #   port = "25575"
+  #   password = ""
+  #   protocol = "rcon"
+
+  ## How long the list of players on the scoreboard is cached before it is
+  ## fetched again, scores are still collected every interval. The list is
+  ## fetched every interval when not set.
+  # player_cache_ttl = "0s"
+
+  ## Scoreboard objectives to collect, globs are supported. Every objective
+  ## is collected when objectives is empty, objectives_exclude takes
+  ## precedence over objectives.
+  # objectives = []
+  # objectives_exclude = []
+
+  ## Emit a minecraft_players metric for each online player along with the
+  ## number of online players.
+  # player_presence = false
+
+  ## Tag the player metrics with the uuid of the player, which unlike the
+  ## name never changes. The uuids are looked up with the Mojang API, or an
+  ## endpoint answering the same way, and cached. The tag is left out when a
+  ## lookup fails.
+  # resolve_uuid = false
+  # uuid_endpoint = "https://api.mojang.com/users/profiles/minecraft/"
+
+  ## Maximum time a collection may take, a server which does not answer in
+  ## time is reconnected to on the next interval.
+  # timeout = "5s"
+
+  ## Time to wait before reconnecting after the connection to the server
+  ## failed, the server is reconnected to on the next interval when not set.
+  # reconnect_backoff = "0s"
+
   ## Uncomment to remove deprecated metric components.
   # tagdrop = ["server"]
 `
@@ -34,54 +82,233 @@ type Client interface {
 
 	// Scores return the objective scores for a player.
 	Scores(player string) ([]Score, error)
+
+	// Online returns the players currently connected to the server.
+	Online() ([]string, error)
+
+	// Close closes the connection to the server, a call blocked on the
+	// server returns an error.
+	Close() error
 }
 
-// Minecraft is the plugin type.
-type Minecraft struct {
+// ServerInfo describes a server, fields unknown to the protocol or missing
+// from the response of the server are left empty.
+type ServerInfo struct {
+	Version    string
+	MOTD       string
+	MaxPlayers int64
+}
+
+// ServerInfoClient is a Client which can describe the server.
+type ServerInfoClient interface {
+	// OnlineInfo returns the players currently connected to the server
+	// along with the version, MOTD and capacity of the server, from a
+	// single request.
+	OnlineInfo() ([]string, *ServerInfo, error)
+}
+
+// ServerConfig is the address and RCON credentials of a server.
+type ServerConfig struct {
 	Server   string `toml:"server"`
 	Port     string `toml:"port"`
 	Password string `toml:"password"`
+	Protocol string `toml:"protocol"`
+}
+
+// Minecraft is the plugin type.
+type Minecraft struct {
+	Server            string            `toml:"server"`
+	Port              string            `toml:"port"`
+	Password          string            `toml:"password"`
+	Protocol          string            `toml:"protocol"`
+	Servers           []ServerConfig    `toml:"servers"`
+	Objectives        []string          `toml:"objectives"`
+	ObjectivesExclude []string          `toml:"objectives_exclude"`
+	PlayerCacheTTL    internal.Duration `toml:"player_cache_ttl"`
+	Timeout           internal.Duration `toml:"timeout"`
+	ReconnectBackoff  internal.Duration `toml:"reconnect_backoff"`
+	PlayerPresence    bool              `toml:"player_presence"`
+	ResolveUUID       bool              `toml:"resolve_uuid"`
+	UUIDEndpoint      string            `toml:"uuid_endpoint"`
+
+	Log cua.Logger `toml:"-"`
+
+	targets       []*target
+	objectives    filter.Filter
+	clientFactory func(ServerConfig) Client
+	now           func() time.Time
+	resolveUUID   func(ctx context.Context, name string) (string, error)
+	uuids         *uuidCache
+}
 
-	client Client
+// target holds the connection and cached state of a gathered server.
+type target struct {
+	ServerConfig
+	client         Client
+	reconnectAt    time.Time
+	players        []string
+	playersFetched time.Time
 }
 
 func (s *Minecraft) Description() string {
-	return "Collects scores from a Minecraft server's scoreboard using the RCON protocol"
+	return "Collects scores from a Minecraft server's scoreboard using the RCON protocol, or online players using the query protocol"
 }
 
 func (s *Minecraft) SampleConfig() string {
 	return sampleConfig
 }
 
+func (s *Minecraft) Init() error {
+	if s.now == nil {
+		s.now = time.Now
+	}
+
+	for option, d := range map[string]time.Duration{
+		"player_cache_ttl":  s.PlayerCacheTTL.Duration,
+		"timeout":           s.Timeout.Duration,
+		"reconnect_backoff": s.ReconnectBackoff.Duration,
+	} {
+		if err := internal.ValidateDuration(option, d, true); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if s.objectives, err = filter.NewIncludeExcludeFilter(s.Objectives, s.ObjectivesExclude); err != nil {
+		return fmt.Errorf("objective filters: %w", err)
+	}
+
+	if s.ResolveUUID {
+		resolve := s.resolveUUID
+		if resolve == nil {
+			endpoint := s.UUIDEndpoint
+			if endpoint == "" {
+				endpoint = defaultUUIDEndpoint
+			}
+			resolve = httpUUIDResolver(endpoint, 5*time.Second)
+		}
+		s.uuids = newUUIDCache(resolve, s.now)
+	}
+
+	var servers []ServerConfig
+	// the single server options are kept for backward compatibility, they
+	// are only ignored when unset and a list of servers is given
+	if s.Server != "" || s.Port != "" || s.Password != "" || len(s.Servers) == 0 {
+		servers = append(servers, ServerConfig{Server: s.Server, Port: s.Port, Password: s.Password, Protocol: s.Protocol})
+	}
+	servers = append(servers, s.Servers...)
+
+	s.targets = make([]*target, 0, len(servers))
+	for _, cfg := range servers {
+		cfg.Server = internal.FirstNonEmpty(cfg.Server, "localhost")
+		cfg.Protocol = internal.FirstNonEmpty(cfg.Protocol, s.Protocol, "rcon")
+		switch cfg.Protocol {
+		case "rcon":
+			cfg.Port = internal.FirstNonEmpty(cfg.Port, "25575")
+		case "query":
+			cfg.Port = internal.FirstNonEmpty(cfg.Port, "25565")
+		default:
+			return fmt.Errorf("invalid protocol %q for %s, must be rcon or query", cfg.Protocol, cfg.Server)
+		}
+		s.targets = append(s.targets, &target{ServerConfig: cfg})
+	}
+	return nil
+}
+
 func (s *Minecraft) Gather(ctx context.Context, acc cua.Accumulator) error {
-	if s.client == nil {
-		connector := newConnector(s.Server, s.Port, s.Password)
-		client := newClient(connector)
-		s.client = client
+	if s.Timeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout.Duration)
+		defer cancel()
+	}
+
+	var wg sync.WaitGroup
+	for _, t := range s.targets {
+		wg.Add(1)
+		go func(t *target) {
+			defer wg.Done()
+			acc.AddError(s.gatherServer(ctx, t, acc))
+		}(t)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// gatherServer gathers the scores of a server, connecting to it when needed.
+func (s *Minecraft) gatherServer(ctx context.Context, t *target, acc cua.Accumulator) error {
+	if t.client == nil {
+		if s.now().Before(t.reconnectAt) {
+			s.Log.Debugf("Waiting until %s to reconnect to %s:%s", t.reconnectAt.Format(time.RFC3339), t.Server, t.Port)
+			return nil
+		}
+		switch {
+		case s.clientFactory != nil:
+			t.client = s.clientFactory(t.ServerConfig)
+		case t.Protocol == "query":
+			t.client = newQueryClient(t.Server, t.Port)
+		default:
+			t.client = newClient(newConnector(t.Server, t.Port, t.Password))
+		}
 	}
 
-	players, err := s.client.Players()
+	if err := s.gatherScores(ctx, t, acc); err != nil {
+		// the connection may have been lost, e.g. because the server
+		// restarted, connect again once the backoff has elapsed. A call
+		// which timed out is still blocked on the client, closing it
+		// releases the connection and the call.
+		t.client.Close()
+		t.client = nil
+		t.reconnectAt = s.now().Add(s.ReconnectBackoff.Duration)
+		return fmt.Errorf("%s:%s: %w", t.Server, t.Port, err)
+	}
+	return nil
+}
+
+func (s *Minecraft) gatherScores(ctx context.Context, t *target, acc cua.Accumulator) error {
+	if err := s.gatherOnline(ctx, t, acc); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		// the scores don't depend on the online players, keep collecting
+		acc.AddError(fmt.Errorf("%s:%s: %w", t.Server, t.Port, err))
+	}
+
+	players, err := s.getPlayers(ctx, t)
 	if err != nil {
-		return fmt.Errorf("players: %w", err)
+		return err
 	}
 
 	for _, player := range players {
-		scores, err := s.client.Scores(player)
+		var scores []Score
+		err := call(ctx, t.client, func(c Client) (err error) {
+			scores, err = c.Scores(player)
+			return err
+		})
 		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("scores: %w", err)
+			}
+			if s.PlayerCacheTTL.Duration > 0 {
+				// the player may have left since the list was cached
+				s.Log.Debugf("Skipping scores of %q: %s", player, err)
+				continue
+			}
 			return fmt.Errorf("scores: %w", err)
 		}
 
-		tags := map[string]string{
-			"player": player,
-			"server": s.Server + ":" + s.Port,
-			"source": s.Server,
-			"port":   s.Port,
-		}
+		tags := s.playerTags(ctx, t, player)
 
 		var fields = make(map[string]interface{}, len(scores))
 		for _, score := range scores {
+			if s.objectives != nil && !s.objectives.Match(score.Name) {
+				continue
+			}
 			fields[score.Name] = score.Value
 		}
+		if len(fields) == 0 {
+			continue
+		}
 
 		acc.AddFields("minecraft", fields, tags)
 	}
@@ -89,11 +316,132 @@ func (s *Minecraft) Gather(ctx context.Context, acc cua.Accumulator) error {
 	return nil
 }
 
+// gatherOnline emits the number of players connected to the server and,
+// when player presence is enabled, a metric per online player. The server is
+// described as well when the client is able to.
+func (s *Minecraft) gatherOnline(ctx context.Context, t *target, acc cua.Accumulator) error {
+	var online []string
+	var info *ServerInfo
+	err := call(ctx, t.client, func(c Client) (err error) {
+		if ic, ok := c.(ServerInfoClient); ok {
+			online, info, err = ic.OnlineInfo()
+			return err
+		}
+		online, err = c.Online()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("online players: %w", err)
+	}
+
+	if info != nil {
+		accServerInfo(t, info, acc)
+	}
+
+	acc.AddFields("minecraft_players", map[string]interface{}{"online_count": int64(len(online))}, t.tags())
+	if !s.PlayerPresence {
+		return nil
+	}
+	for _, player := range online {
+		tags := s.playerTags(ctx, t, player)
+		acc.AddFields("minecraft_players", map[string]interface{}{"online": int64(1)}, tags)
+	}
+	return nil
+}
+
+// accServerInfo emits the version, MOTD and capacity of the server, leaving
+// out what is unknown.
+func accServerInfo(t *target, info *ServerInfo, acc cua.Accumulator) {
+	tags := t.tags()
+	if info.Version != "" {
+		tags["version"] = info.Version
+	}
+	fields := make(map[string]interface{}, 2)
+	if info.MaxPlayers > 0 {
+		fields["max_players"] = info.MaxPlayers
+	}
+	if info.MOTD != "" {
+		fields["motd"] = info.MOTD
+	}
+	if len(fields) == 0 {
+		return
+	}
+	acc.AddFields("minecraft_server", fields, tags)
+}
+
+// playerTags returns the tags identifying a player of the server, along with
+// the uuid of the player when it is resolved.
+func (s *Minecraft) playerTags(ctx context.Context, t *target, player string) map[string]string {
+	tags := t.tags()
+	tags["player"] = player
+	if s.uuids == nil {
+		return tags
+	}
+	uuid, err := s.uuids.UUID(ctx, player)
+	if err != nil {
+		s.Log.Debugf("Resolving the uuid of %q failed: %s", player, err)
+	}
+	if uuid != "" {
+		tags["uuid"] = uuid
+	}
+	return tags
+}
+
+// tags returns the tags identifying the server.
+func (t *target) tags() map[string]string {
+	return map[string]string{
+		"server": t.Server + ":" + t.Port,
+		"source": t.Server,
+		"port":   t.Port,
+	}
+}
+
+// call runs f with the client, returning early when the context is done
+// before f returns. The client may still be blocked on the server then, the
+// error makes the client be closed and dropped so a new one connects, f
+// returns once the client is closed.
+func call(ctx context.Context, client Client, f func(c Client) error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- f(client)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// getPlayers returns the players on the scoreboard of the server, the list
+// is only fetched from the server once the player cache TTL has elapsed.
+func (s *Minecraft) getPlayers(ctx context.Context, t *target) ([]string, error) {
+	ttl := s.PlayerCacheTTL.Duration
+	if ttl > 0 && t.players != nil && s.now().Sub(t.playersFetched) < ttl {
+		return t.players, nil
+	}
+
+	var players []string
+	err := call(ctx, t.client, func(c Client) (err error) {
+		players, err = c.Players()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("players: %w", err)
+	}
+
+	if ttl > 0 {
+		t.players = players
+		t.playersFetched = s.now()
+	}
+	return players, nil
+}
+
 func init() {
 	inputs.Add("minecraft", func() cua.Input {
 		return &Minecraft{
-			Server: "localhost",
-			Port:   "25575",
+			Timeout: internal.Duration{Duration: 5 * time.Second},
 		}
 	})
 }
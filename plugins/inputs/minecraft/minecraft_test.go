@@ -2,10 +2,12 @@ package minecraft
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/internal"
 	"github.com/circonus-labs/circonus-unified-agent/testutil"
 	"github.com/stretchr/testify/require"
 )
@@ -14,6 +16,8 @@ type MockClient struct {
 	ConnectF func() error
 	PlayersF func() ([]string, error)
 	ScoresF  func(player string) ([]Score, error)
+	OnlineF  func() ([]string, error)
+	CloseF   func() error
 }
 
 func (c *MockClient) Connect() error {
@@ -28,6 +32,37 @@ func (c *MockClient) Scores(player string) ([]Score, error) {
 	return c.ScoresF(player)
 }
 
+func (c *MockClient) Online() ([]string, error) {
+	if c.OnlineF == nil {
+		return []string{}, nil
+	}
+	return c.OnlineF()
+}
+
+func (c *MockClient) Close() error {
+	if c.CloseF == nil {
+		return nil
+	}
+	return c.CloseF()
+}
+
+// MockInfoClient is a MockClient which can describe the server.
+type MockInfoClient struct {
+	MockClient
+	OnlineInfoF func() ([]string, *ServerInfo, error)
+}
+
+func (c *MockInfoClient) OnlineInfo() ([]string, *ServerInfo, error) {
+	return c.OnlineInfoF()
+}
+
+// mockFactory returns a client factory always returning c.
+func mockFactory(c Client) func(ServerConfig) Client {
+	return func(ServerConfig) Client {
+		return c
+	}
+}
+
 func TestGather(t *testing.T) {
 	now := time.Unix(0, 0)
 
@@ -108,19 +143,671 @@ func TestGather(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			plugin := &Minecraft{
-				Server:   "example.org",
-				Port:     "25575",
-				Password: "xyzzy",
-				client:   tt.client,
+				Server:        "example.org",
+				Port:          "25575",
+				Password:      "xyzzy",
+				clientFactory: mockFactory(tt.client),
 			}
+			require.NoError(t, plugin.Init())
 
 			var acc testutil.Accumulator
 			acc.TimeFunc = func() time.Time { return now }
 
-			err := plugin.Gather(context.Background(), &acc)
+			require.NoError(t, plugin.Gather(context.Background(), &acc))
 
-			require.Equal(t, tt.err, err)
-			testutil.RequireMetricsEqual(t, tt.metrics, acc.GetCUAMetrics())
+			online := testutil.MustMetric(
+				"minecraft_players",
+				map[string]string{
+					"server": "example.org:25575",
+					"source": "example.org",
+					"port":   "25575",
+				},
+				map[string]interface{}{
+					"online_count": 0,
+				},
+				now,
+			)
+
+			require.Equal(t, tt.err, acc.FirstError())
+			testutil.RequireMetricsEqual(t, append([]cua.Metric{online}, tt.metrics...), acc.GetCUAMetrics())
 		})
 	}
 }
+
+func TestGatherPlayerCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	playersCalls := 0
+	players := []string{"Etho", "notch"}
+
+	client := &MockClient{
+		ConnectF: func() error {
+			return nil
+		},
+		PlayersF: func() ([]string, error) {
+			playersCalls++
+			return players, nil
+		},
+		ScoresF: func(player string) ([]Score, error) {
+			switch player {
+			case "Etho", "dinnerbone":
+				return []Score{{Name: "jumps", Value: 42}}, nil
+			default:
+				return nil, errors.New("player left")
+			}
+		},
+	}
+
+	plugin := &Minecraft{
+		Server:         "example.org",
+		Port:           "25575",
+		PlayerCacheTTL: internal.Duration{Duration: time.Minute},
+		Log:            testutil.Logger{},
+		clientFactory:  mockFactory(client),
+		now:            func() time.Time { return now },
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.Equal(t, 1, playersCalls)
+	require.Equal(t, uint64(2), acc.NMetrics())
+
+	// the cached roster is used until the TTL elapses, scores are still
+	// fetched every gather
+	players = []string{"dinnerbone"}
+	now = now.Add(30 * time.Second)
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.Equal(t, 1, playersCalls)
+	require.Equal(t, uint64(2), acc.NMetrics())
+	require.True(t, acc.HasPoint("minecraft", map[string]string{
+		"player": "Etho",
+		"server": "example.org:25575",
+		"source": "example.org",
+		"port":   "25575",
+	}, "jumps", int64(42)))
+
+	now = now.Add(30 * time.Second)
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.Equal(t, 2, playersCalls)
+	require.True(t, acc.HasPoint("minecraft", map[string]string{
+		"player": "dinnerbone",
+		"server": "example.org:25575",
+		"source": "example.org",
+		"port":   "25575",
+	}, "jumps", int64(42)))
+}
+
+func TestGatherNoPlayerCache(t *testing.T) {
+	playersCalls := 0
+	plugin := &Minecraft{
+		Server: "example.org",
+		Port:   "25575",
+		clientFactory: mockFactory(&MockClient{
+			PlayersF: func() ([]string, error) {
+				playersCalls++
+				return []string{}, nil
+			},
+		}),
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.Equal(t, 2, playersCalls)
+}
+
+func TestGatherCancelled(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	client := &MockClient{
+		PlayersF: func() ([]string, error) {
+			<-block
+			return nil, errors.New("unblocked")
+		},
+	}
+
+	plugin := &Minecraft{
+		Server:        "example.org",
+		Port:          "25575",
+		clientFactory: mockFactory(client),
+	}
+	require.NoError(t, plugin.Init())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(ctx, &acc))
+	require.True(t, errors.Is(acc.FirstError(), context.Canceled))
+	// the blocked client is dropped so the next gather reconnects
+	require.Nil(t, plugin.targets[0].client)
+}
+
+func TestGatherTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	client := &MockClient{
+		PlayersF: func() ([]string, error) {
+			return []string{"Etho"}, nil
+		},
+		ScoresF: func(player string) ([]Score, error) {
+			<-block
+			return nil, errors.New("unblocked")
+		},
+	}
+
+	plugin := &Minecraft{
+		Server:        "example.org",
+		Port:          "25575",
+		Timeout:       internal.Duration{Duration: 10 * time.Millisecond},
+		clientFactory: mockFactory(client),
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	start := time.Now()
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.True(t, errors.Is(acc.FirstError(), context.DeadlineExceeded))
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+	require.False(t, acc.HasMeasurement("minecraft"))
+}
+
+func TestGatherTimeoutClosesClient(t *testing.T) {
+	closed := make(chan struct{})
+	returned := make(chan struct{})
+
+	client := &MockClient{
+		PlayersF: func() ([]string, error) {
+			defer close(returned)
+			<-closed
+			return nil, errClientClosed
+		},
+		CloseF: func() error {
+			close(closed)
+			return nil
+		},
+	}
+
+	plugin := &Minecraft{
+		Server:        "example.org",
+		Port:          "25575",
+		Timeout:       internal.Duration{Duration: 10 * time.Millisecond},
+		clientFactory: mockFactory(client),
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.True(t, errors.Is(acc.FirstError(), context.DeadlineExceeded))
+
+	// the abandoned call is released by closing the client
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("blocked call not released")
+	}
+}
+
+func TestGatherReconnects(t *testing.T) {
+	now := time.Unix(0, 0)
+	var clients []*MockClient
+	newMock := func(fail bool) *MockClient {
+		return &MockClient{
+			PlayersF: func() ([]string, error) {
+				if fail {
+					return nil, errors.New("connection reset by peer")
+				}
+				return []string{"Etho"}, nil
+			},
+			ScoresF: func(player string) ([]Score, error) {
+				return []Score{{Name: "jumps", Value: 42}}, nil
+			},
+		}
+	}
+
+	plugin := &Minecraft{
+		Server:           "example.org",
+		Port:             "25575",
+		ReconnectBackoff: internal.Duration{Duration: time.Minute},
+		Log:              testutil.Logger{},
+		now:              func() time.Time { return now },
+		clientFactory: func(ServerConfig) Client {
+			c := newMock(len(clients) == 0)
+			clients = append(clients, c)
+			return c
+		},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.Error(t, acc.FirstError())
+	require.Len(t, clients, 1)
+	require.Nil(t, plugin.targets[0].client)
+
+	// no reconnection attempt until the backoff has elapsed
+	now = now.Add(30 * time.Second)
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.Len(t, clients, 1)
+	require.False(t, acc.HasMeasurement("minecraft"))
+
+	now = now.Add(30 * time.Second)
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.Len(t, clients, 2)
+	require.True(t, acc.HasPoint("minecraft", map[string]string{
+		"player": "Etho",
+		"server": "example.org:25575",
+		"source": "example.org",
+		"port":   "25575",
+	}, "jumps", int64(42)))
+
+	// the working client is kept
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.Len(t, clients, 2)
+}
+
+func TestGatherMultipleServers(t *testing.T) {
+	plugin := &Minecraft{
+		Servers: []ServerConfig{
+			{Server: "mc1.example.org", Password: "one"},
+			{Server: "mc2.example.org", Port: "25576", Password: "two"},
+		},
+		clientFactory: func(cfg ServerConfig) Client {
+			return &MockClient{
+				PlayersF: func() ([]string, error) {
+					return []string{"player-" + cfg.Password}, nil
+				},
+				ScoresF: func(player string) ([]Score, error) {
+					return []Score{{Name: "jumps", Value: int64(len(cfg.Password))}}, nil
+				},
+			}
+		},
+	}
+	require.NoError(t, plugin.Init())
+	require.Len(t, plugin.targets, 2)
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.NoError(t, acc.FirstError())
+	require.Equal(t, uint64(4), acc.NMetrics())
+	require.True(t, acc.HasPoint("minecraft", map[string]string{
+		"player": "player-one",
+		"server": "mc1.example.org:25575",
+		"source": "mc1.example.org",
+		"port":   "25575",
+	}, "jumps", int64(3)))
+	require.True(t, acc.HasPoint("minecraft", map[string]string{
+		"player": "player-two",
+		"server": "mc2.example.org:25576",
+		"source": "mc2.example.org",
+		"port":   "25576",
+	}, "jumps", int64(3)))
+}
+
+func TestInitServers(t *testing.T) {
+	tests := []struct {
+		name     string
+		plugin   *Minecraft
+		expected []ServerConfig
+	}{
+		{
+			name:     "defaults",
+			plugin:   &Minecraft{},
+			expected: []ServerConfig{{Server: "localhost", Port: "25575", Protocol: "rcon"}},
+		},
+		{
+			name:     "query defaults",
+			plugin:   &Minecraft{Protocol: "query"},
+			expected: []ServerConfig{{Server: "localhost", Port: "25565", Protocol: "query"}},
+		},
+		{
+			name:   "single server",
+			plugin: &Minecraft{Server: "example.org", Password: "xyzzy"},
+			expected: []ServerConfig{
+				{Server: "example.org", Port: "25575", Password: "xyzzy", Protocol: "rcon"},
+			},
+		},
+		{
+			name: "single server merged into the list",
+			plugin: &Minecraft{
+				Server:  "example.org",
+				Servers: []ServerConfig{{Server: "mc1.example.org", Port: "25576"}},
+			},
+			expected: []ServerConfig{
+				{Server: "example.org", Port: "25575", Protocol: "rcon"},
+				{Server: "mc1.example.org", Port: "25576", Protocol: "rcon"},
+			},
+		},
+		{
+			name: "list only",
+			plugin: &Minecraft{
+				Servers: []ServerConfig{{Server: "mc1.example.org"}},
+			},
+			expected: []ServerConfig{{Server: "mc1.example.org", Port: "25575", Protocol: "rcon"}},
+		},
+		{
+			name: "query protocol",
+			plugin: &Minecraft{
+				Protocol: "query",
+				Servers: []ServerConfig{
+					{Server: "mc1.example.org", Protocol: "rcon"},
+					{Server: "mc2.example.org", Port: "25570"},
+				},
+			},
+			expected: []ServerConfig{
+				{Server: "mc1.example.org", Port: "25575", Protocol: "rcon"},
+				{Server: "mc2.example.org", Port: "25570", Protocol: "query"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.plugin.Init())
+			var servers []ServerConfig
+			for _, target := range tt.plugin.targets {
+				servers = append(servers, target.ServerConfig)
+			}
+			require.Equal(t, tt.expected, servers)
+		})
+	}
+}
+
+func TestInitInvalidProtocol(t *testing.T) {
+	plugin := &Minecraft{Protocol: "http"}
+	require.Error(t, plugin.Init())
+}
+
+func TestInitNegativeDuration(t *testing.T) {
+	plugin := &Minecraft{Timeout: internal.Duration{Duration: -time.Second}}
+	require.EqualError(t, plugin.Init(), "timeout must not be negative, got -1s")
+}
+
+func TestGatherObjectiveFilters(t *testing.T) {
+	scores := []Score{
+		{Name: "jumps", Value: 42},
+		{Name: "deaths", Value: 1},
+		{Name: "kills_zombie", Value: 7},
+		{Name: "kills_creeper", Value: 3},
+	}
+
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		expected map[string]interface{}
+	}{
+		{
+			name: "no filters",
+			expected: map[string]interface{}{
+				"jumps": int64(42), "deaths": int64(1), "kills_zombie": int64(7), "kills_creeper": int64(3),
+			},
+		},
+		{
+			name:     "include",
+			include:  []string{"jumps", "kills_*"},
+			expected: map[string]interface{}{"jumps": int64(42), "kills_zombie": int64(7), "kills_creeper": int64(3)},
+		},
+		{
+			name:     "exclude",
+			exclude:  []string{"kills_*"},
+			expected: map[string]interface{}{"jumps": int64(42), "deaths": int64(1)},
+		},
+		{
+			name:     "include and exclude",
+			include:  []string{"kills_*"},
+			exclude:  []string{"kills_creeper"},
+			expected: map[string]interface{}{"kills_zombie": int64(7)},
+		},
+		{
+			name:    "everything filtered",
+			include: []string{"level"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &Minecraft{
+				Objectives:        tt.include,
+				ObjectivesExclude: tt.exclude,
+				clientFactory: mockFactory(&MockClient{
+					PlayersF: func() ([]string, error) {
+						return []string{"Etho"}, nil
+					},
+					ScoresF: func(player string) ([]Score, error) {
+						return scores, nil
+					},
+				}),
+			}
+			require.NoError(t, plugin.Init())
+
+			var acc testutil.Accumulator
+			require.NoError(t, plugin.Gather(context.Background(), &acc))
+			require.NoError(t, acc.FirstError())
+			var fields []map[string]interface{}
+			for _, m := range acc.Metrics {
+				if m.Measurement == "minecraft" {
+					fields = append(fields, m.Fields)
+				}
+			}
+			if tt.expected == nil {
+				require.Empty(t, fields)
+				return
+			}
+			require.Equal(t, []map[string]interface{}{tt.expected}, fields)
+		})
+	}
+}
+
+func TestGatherOnlinePlayers(t *testing.T) {
+	client := &MockClient{
+		PlayersF: func() ([]string, error) {
+			return []string{}, nil
+		},
+		OnlineF: func() ([]string, error) {
+			return []string{"Etho", "notch", "jeb"}, nil
+		},
+	}
+
+	serverTags := map[string]string{
+		"server": "example.org:25575",
+		"source": "example.org",
+		"port":   "25575",
+	}
+
+	plugin := &Minecraft{
+		Server:        "example.org",
+		clientFactory: mockFactory(client),
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.NoError(t, acc.FirstError())
+	require.Equal(t, uint64(1), acc.NMetrics())
+	require.True(t, acc.HasPoint("minecraft_players", serverTags, "online_count", int64(3)))
+
+	plugin.PlayerPresence = true
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.Equal(t, uint64(4), acc.NMetrics())
+	require.True(t, acc.HasPoint("minecraft_players", serverTags, "online_count", int64(3)))
+	for _, player := range []string{"Etho", "notch", "jeb"} {
+		tags := map[string]string{"player": player}
+		for k, v := range serverTags {
+			tags[k] = v
+		}
+		require.True(t, acc.HasPoint("minecraft_players", tags, "online", int64(1)))
+	}
+}
+
+func TestGatherOnlinePlayersError(t *testing.T) {
+	client := &MockClient{
+		PlayersF: func() ([]string, error) {
+			return []string{"Etho"}, nil
+		},
+		ScoresF: func(player string) ([]Score, error) {
+			return []Score{{Name: "jumps", Value: 42}}, nil
+		},
+		OnlineF: func() ([]string, error) {
+			return nil, errors.New("unknown command")
+		},
+	}
+
+	plugin := &Minecraft{
+		Server:        "example.org",
+		clientFactory: mockFactory(client),
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.Error(t, acc.FirstError())
+	require.False(t, acc.HasMeasurement("minecraft_players"))
+	require.True(t, acc.HasPoint("minecraft", map[string]string{
+		"player": "Etho",
+		"server": "example.org:25575",
+		"source": "example.org",
+		"port":   "25575",
+	}, "jumps", int64(42)))
+	// the client is kept
+	require.NotNil(t, plugin.targets[0].client)
+}
+
+func TestGatherServerInfo(t *testing.T) {
+	client := &MockInfoClient{
+		MockClient: MockClient{
+			PlayersF: func() ([]string, error) {
+				return []string{}, nil
+			},
+			OnlineF: func() ([]string, error) {
+				return nil, errors.New("online players are described with the server")
+			},
+		},
+		OnlineInfoF: func() ([]string, *ServerInfo, error) {
+			return []string{"Etho", "notch"}, &ServerInfo{
+				Version:    "1.16.5",
+				MOTD:       "A Minecraft Server",
+				MaxPlayers: 20,
+			}, nil
+		},
+	}
+
+	plugin := &Minecraft{
+		Server:        "example.org",
+		Protocol:      "query",
+		clientFactory: mockFactory(client),
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.NoError(t, acc.FirstError())
+
+	expected := []cua.Metric{
+		testutil.MustMetric(
+			"minecraft_players",
+			map[string]string{
+				"server": "example.org:25565",
+				"source": "example.org",
+				"port":   "25565",
+			},
+			map[string]interface{}{"online_count": int64(2)},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"minecraft_server",
+			map[string]string{
+				"server":  "example.org:25565",
+				"source":  "example.org",
+				"port":    "25565",
+				"version": "1.16.5",
+			},
+			map[string]interface{}{
+				"max_players": int64(20),
+				"motd":        "A Minecraft Server",
+			},
+			time.Unix(0, 0),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetCUAMetrics(), testutil.IgnoreTime(), testutil.SortMetrics())
+
+	// the capacity is left out when the server doesn't report it
+	client.OnlineInfoF = func() ([]string, *ServerInfo, error) {
+		return []string{"Etho"}, &ServerInfo{}, nil
+	}
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.NoError(t, acc.FirstError())
+	require.True(t, acc.HasMeasurement("minecraft_players"))
+	require.False(t, acc.HasMeasurement("minecraft_server"))
+
+	client.OnlineInfoF = func() ([]string, *ServerInfo, error) {
+		return nil, nil, errors.New("timeout")
+	}
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.Error(t, acc.FirstError())
+}
+
+func TestGatherResolveUUID(t *testing.T) {
+	client := &MockClient{
+		PlayersF: func() ([]string, error) {
+			return []string{"Etho", "ghost"}, nil
+		},
+		ScoresF: func(player string) ([]Score, error) {
+			return []Score{{Name: "jumps", Value: 42}}, nil
+		},
+		OnlineF: func() ([]string, error) {
+			return []string{"Etho"}, nil
+		},
+	}
+
+	plugin := &Minecraft{
+		Server:         "example.org",
+		PlayerPresence: true,
+		ResolveUUID:    true,
+		Log:            testutil.Logger{},
+		clientFactory:  mockFactory(client),
+		resolveUUID: func(_ context.Context, name string) (string, error) {
+			if name == "Etho" {
+				return "ee9cc7f2a2c1406aa66b8b3df1a8e4b5", nil
+			}
+			return "", errors.New("lookup failed")
+		},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	require.NoError(t, acc.FirstError())
+
+	serverTags := map[string]string{
+		"server": "example.org:25575",
+		"source": "example.org",
+		"port":   "25575",
+	}
+	etho := map[string]string{"player": "Etho", "uuid": "ee9cc7f2a2c1406aa66b8b3df1a8e4b5"}
+	ghost := map[string]string{"player": "ghost"}
+	for k, v := range serverTags {
+		etho[k] = v
+		ghost[k] = v
+	}
+
+	expected := []cua.Metric{
+		testutil.MustMetric("minecraft_players", serverTags, map[string]interface{}{"online_count": int64(1)}, time.Unix(0, 0)),
+		testutil.MustMetric("minecraft_players", etho, map[string]interface{}{"online": int64(1)}, time.Unix(0, 0)),
+		testutil.MustMetric("minecraft", etho, map[string]interface{}{"jumps": int64(42)}, time.Unix(0, 0)),
+		// the failed lookup leaves the uuid out
+		testutil.MustMetric("minecraft", ghost, map[string]interface{}{"jumps": int64(42)}, time.Unix(0, 0)),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetCUAMetrics(), testutil.IgnoreTime())
+}
@@ -0,0 +1,263 @@
+package minecraft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The query protocol is a UDP protocol exposing the server status without
+// authentication, it is enabled with enable-query in server.properties. A
+// handshake returns a challenge token which is then sent with the full stat
+// request.
+const (
+	queryTypeHandshake byte = 0x09
+	queryTypeStat      byte = 0x00
+
+	// queryDeadline bounds each exchange with the server, UDP gives no
+	// other indication of an unreachable server.
+	queryDeadline = 5 * time.Second
+)
+
+var (
+	queryMagic = []byte{0xFE, 0xFD}
+	// the full stat response pads the key/value section and player list
+	// with these constant strings
+	queryStatPadding   = []byte("splitnum\x00\x80\x00")
+	queryPlayerPadding = []byte("\x01player_\x00\x00")
+)
+
+// queryStat is the full stat of a server returned by the query protocol.
+type queryStat struct {
+	MOTD       string
+	Version    string
+	NumPlayers int
+	MaxPlayers int
+	Players    []string
+}
+
+func newQueryClient(hostname, port string) *queryClient {
+	return &queryClient{address: net.JoinHostPort(hostname, port)}
+}
+
+// queryClient is a Client using the query protocol. The scoreboard is not
+// exposed by the protocol, so only the online players are known.
+type queryClient struct {
+	address   string
+	sessionID int32
+
+	// mu guards the connection, which Close drops while a request may be
+	// waiting on it
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+}
+
+func (c *queryClient) Connect() error {
+	_, err := c.connect()
+	return err
+}
+
+func (c *queryClient) connect() (net.Conn, error) {
+	conn, err := net.Dial("udp", c.address)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	// only the lower 4 bits of each byte of the session id are used
+	c.sessionID = rand.Int31() & 0x0F0F0F0F //nolint:gosec // not a secret
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		conn.Close()
+		return nil, errClientClosed
+	}
+	c.conn = conn
+	return conn, nil
+}
+
+// Close closes the connection, a request waiting on it returns an error.
+func (c *queryClient) Close() error {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.closed = true
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+func (c *queryClient) Players() ([]string, error) {
+	return []string{}, nil
+}
+
+func (c *queryClient) Scores(player string) ([]Score, error) {
+	return []Score{}, nil
+}
+
+func (c *queryClient) Online() ([]string, error) {
+	stat, err := c.stat()
+	if err != nil {
+		return nil, err
+	}
+	return stat.Players, nil
+}
+
+func (c *queryClient) OnlineInfo() ([]string, *ServerInfo, error) {
+	stat, err := c.stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	return stat.Players, &ServerInfo{
+		Version:    stat.Version,
+		MOTD:       stat.MOTD,
+		MaxPlayers: int64(stat.MaxPlayers),
+	}, nil
+}
+
+// stat runs the handshake and full stat request, dropping the connection on
+// failure so the next call connects again.
+func (c *queryClient) stat() (*queryStat, error) {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		var err error
+		if conn, err = c.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	stat, err := c.exchangeStat(conn)
+	if err != nil {
+		c.mu.Lock()
+		if c.conn == conn {
+			c.conn = nil
+		}
+		c.mu.Unlock()
+		conn.Close()
+		return nil, err
+	}
+	return stat, nil
+}
+
+func (c *queryClient) exchangeStat(conn net.Conn) (*queryStat, error) {
+	if err := conn.SetDeadline(time.Now().Add(queryDeadline)); err != nil {
+		return nil, fmt.Errorf("set deadline: %w", err)
+	}
+
+	resp, err := c.exchange(conn, queryTypeHandshake, nil)
+	if err != nil {
+		return nil, fmt.Errorf("handshake: %w", err)
+	}
+	token, err := strconv.ParseInt(string(bytes.TrimRight(resp, "\x00")), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("challenge token: %w", err)
+	}
+
+	payload := make([]byte, 8) // token followed by padding requesting the full stat
+	binary.BigEndian.PutUint32(payload, uint32(token))
+	if resp, err = c.exchange(conn, queryTypeStat, payload); err != nil {
+		return nil, fmt.Errorf("full stat: %w", err)
+	}
+	return parseFullStat(resp)
+}
+
+// exchange sends a request and returns the payload of its response.
+func (c *queryClient) exchange(conn net.Conn, typ byte, payload []byte) ([]byte, error) {
+	req := make([]byte, 0, 7+len(payload))
+	req = append(req, queryMagic...)
+	req = append(req, typ)
+	req = append(req, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(req[3:7], uint32(c.sessionID))
+	req = append(req, payload...)
+	if _, err := conn.Write(req); err != nil {
+		return nil, fmt.Errorf("write: %w", err)
+	}
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	buf = buf[:n]
+	if len(buf) < 5 || buf[0] != typ || int32(binary.BigEndian.Uint32(buf[1:5])) != c.sessionID {
+		return nil, fmt.Errorf("unexpected response")
+	}
+	return buf[5:], nil
+}
+
+// parseFullStat parses the payload of a full stat response: the padding, a
+// list of null terminated key and value strings ending with an empty key,
+// another padding and the null terminated player names ending with an
+// empty name.
+func parseFullStat(payload []byte) (*queryStat, error) {
+	if !bytes.HasPrefix(payload, queryStatPadding) {
+		return nil, fmt.Errorf("malformed full stat: missing padding")
+	}
+	rest := payload[len(queryStatPadding):]
+
+	next := func() (string, bool) {
+		i := bytes.IndexByte(rest, 0)
+		if i < 0 {
+			return "", false
+		}
+		s := string(rest[:i])
+		rest = rest[i+1:]
+		return s, true
+	}
+
+	stat := &queryStat{}
+	for {
+		key, ok := next()
+		if !ok {
+			return nil, fmt.Errorf("malformed full stat: unterminated key")
+		}
+		if key == "" {
+			break
+		}
+		value, ok := next()
+		if !ok {
+			return nil, fmt.Errorf("malformed full stat: unterminated value of %s", key)
+		}
+
+		var err error
+		switch key {
+		case "hostname":
+			stat.MOTD = value
+		case "version":
+			stat.Version = value
+		case "numplayers":
+			stat.NumPlayers, err = strconv.Atoi(value)
+		case "maxplayers":
+			stat.MaxPlayers, err = strconv.Atoi(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed full stat: %s: %w", key, err)
+		}
+	}
+
+	if !bytes.HasPrefix(rest, queryPlayerPadding) {
+		return nil, fmt.Errorf("malformed full stat: missing player padding")
+	}
+	rest = rest[len(queryPlayerPadding):]
+
+	stat.Players = []string{}
+	for {
+		name, ok := next()
+		if !ok || name == "" {
+			break
+		}
+		stat.Players = append(stat.Players, name)
+	}
+	return stat, nil
+}
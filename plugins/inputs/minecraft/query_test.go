@@ -0,0 +1,160 @@
+package minecraft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fullStatResponse is the payload of a full stat response recorded from a
+// vanilla 1.16 server, after the type and session id.
+var fullStatResponse = []byte("splitnum\x00\x80\x00" +
+	"hostname\x00A Minecraft Server\x00" +
+	"gametype\x00SMP\x00" +
+	"game_id\x00MINECRAFT\x00" +
+	"version\x001.16.5\x00" +
+	"plugins\x00\x00" +
+	"map\x00world\x00" +
+	"numplayers\x002\x00" +
+	"maxplayers\x0020\x00" +
+	"hostport\x0025565\x00" +
+	"hostip\x00127.0.0.1\x00" +
+	"\x00" +
+	"\x01player_\x00\x00" +
+	"Etho\x00notch\x00" +
+	"\x00")
+
+func TestParseFullStat(t *testing.T) {
+	stat, err := parseFullStat(fullStatResponse)
+	require.NoError(t, err)
+	require.Equal(t, &queryStat{
+		MOTD:       "A Minecraft Server",
+		Version:    "1.16.5",
+		NumPlayers: 2,
+		MaxPlayers: 20,
+		Players:    []string{"Etho", "notch"},
+	}, stat)
+}
+
+func TestParseFullStatNoPlayers(t *testing.T) {
+	payload := []byte("splitnum\x00\x80\x00numplayers\x000\x00maxplayers\x0020\x00\x00\x01player_\x00\x00\x00")
+	stat, err := parseFullStat(payload)
+	require.NoError(t, err)
+	require.Equal(t, 0, stat.NumPlayers)
+	require.Equal(t, []string{}, stat.Players)
+}
+
+func TestParseFullStatMalformed(t *testing.T) {
+	for _, payload := range []string{
+		"",
+		"splitnum\x00\x80\x00hostname",
+		"splitnum\x00\x80\x00hostname\x00motd",
+		"splitnum\x00\x80\x00numplayers\x00two\x00\x00\x01player_\x00\x00\x00",
+		"splitnum\x00\x80\x00\x00Etho\x00\x00",
+	} {
+		_, err := parseFullStat([]byte(payload))
+		require.Error(t, err, "%q", payload)
+	}
+}
+
+// serveQuery answers the handshake and full stat requests of one client
+// like a server with the given challenge token.
+func serveQuery(t *testing.T, conn net.PacketConn, token string) {
+	buf := make([]byte, 1024)
+	for i := 0; i < 2; i++ {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req := buf[:n]
+		if !bytes.HasPrefix(req, queryMagic) || n < 7 {
+			t.Errorf("invalid request %x", req)
+			return
+		}
+
+		resp := append([]byte{req[2]}, req[3:7]...)
+		switch req[2] {
+		case queryTypeHandshake:
+			resp = append(resp, token+"\x00"...)
+		case queryTypeStat:
+			if got := int32(binary.BigEndian.Uint32(req[7:11])); got != 9513307 {
+				t.Errorf("unexpected challenge token %d", got)
+			}
+			resp = append(resp, fullStatResponse...)
+		}
+		if _, err := conn.WriteTo(resp, addr); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+}
+
+func TestQueryClientOnline(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	go serveQuery(t, conn, "9513307")
+
+	host, port, err := net.SplitHostPort(conn.LocalAddr().String())
+	require.NoError(t, err)
+
+	client := newQueryClient(host, port)
+	online, err := client.Online()
+	require.NoError(t, err)
+	require.Equal(t, []string{"Etho", "notch"}, online)
+
+	players, err := client.Players()
+	require.NoError(t, err)
+	require.Empty(t, players)
+}
+
+func TestQueryClientOnlineInfo(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	go serveQuery(t, conn, "9513307")
+
+	host, port, err := net.SplitHostPort(conn.LocalAddr().String())
+	require.NoError(t, err)
+
+	online, info, err := newQueryClient(host, port).OnlineInfo()
+	require.NoError(t, err)
+	require.Equal(t, []string{"Etho", "notch"}, online)
+	require.Equal(t, &ServerInfo{
+		Version:    "1.16.5",
+		MOTD:       "A Minecraft Server",
+		MaxPlayers: 20,
+	}, info)
+}
+
+func TestQueryClientClose(t *testing.T) {
+	// a server which never answers
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	host, port, err := net.SplitHostPort(conn.LocalAddr().String())
+	require.NoError(t, err)
+
+	client := newQueryClient(host, port)
+	require.NoError(t, client.Connect())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Online()
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, client.Close())
+	select {
+	case err := <-done:
+		require.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("request not released by close")
+	}
+}
@@ -0,0 +1,102 @@
+package minecraft
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUUIDEndpoint = "https://api.mojang.com/users/profiles/minecraft/"
+
+	// uuidTTL is how long a resolved uuid is used before it is looked up
+	// again, failed lookups are retried after uuidFailureTTL so an
+	// unavailable API is not hammered on every interval.
+	uuidTTL        = 24 * time.Hour
+	uuidFailureTTL = 5 * time.Minute
+)
+
+// uuidEntry is a cached lookup, a failed lookup has no uuid.
+type uuidEntry struct {
+	uuid    string
+	expires time.Time
+}
+
+// uuidCache caches the uuids of players resolved by resolve, it is shared by
+// the servers gathered concurrently.
+type uuidCache struct {
+	resolve func(ctx context.Context, name string) (string, error)
+	now     func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]uuidEntry
+}
+
+func newUUIDCache(resolve func(ctx context.Context, name string) (string, error), now func() time.Time) *uuidCache {
+	return &uuidCache{
+		resolve: resolve,
+		now:     now,
+		entries: make(map[string]uuidEntry),
+	}
+}
+
+// UUID returns the uuid of the player, or an empty uuid when it can't be
+// resolved along with the error of the lookup when it was not cached.
+func (c *uuidCache) UUID(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return entry.uuid, nil
+	}
+
+	uuid, err := c.resolve(ctx, name)
+	entry = uuidEntry{uuid: uuid, expires: c.now().Add(uuidTTL)}
+	if err != nil {
+		entry = uuidEntry{expires: c.now().Add(uuidFailureTTL)}
+	}
+
+	c.mu.Lock()
+	c.entries[name] = entry
+	c.mu.Unlock()
+	return entry.uuid, err
+}
+
+// httpUUIDResolver returns a resolver looking up players with the Mojang
+// profile API, or an endpoint answering the same way, at endpoint followed
+// by the player name.
+func httpUUIDResolver(endpoint string, timeout time.Duration) func(ctx context.Context, name string) (string, error) {
+	client := &http.Client{Timeout: timeout}
+	return func(ctx context.Context, name string) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+url.PathEscape(name), nil)
+		if err != nil {
+			return "", fmt.Errorf("new request: %w", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("lookup %q: %w", name, err)
+		}
+		defer resp.Body.Close()
+
+		// the API answers 204 No Content for unknown players
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("lookup %q: %s", name, resp.Status)
+		}
+		var profile struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+			return "", fmt.Errorf("lookup %q: decode: %w", name, err)
+		}
+		if profile.ID == "" {
+			return "", fmt.Errorf("lookup %q: no id", name)
+		}
+		return strings.ToLower(profile.ID), nil
+	}
+}
@@ -0,0 +1,77 @@
+package minecraft
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUUIDCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	lookups := map[string]int{}
+	cache := newUUIDCache(func(_ context.Context, name string) (string, error) {
+		lookups[name]++
+		if name == "ghost" {
+			return "", errors.New("204 No Content")
+		}
+		return "uuid-" + name, nil
+	}, func() time.Time { return now })
+
+	uuid, err := cache.UUID(context.Background(), "Etho")
+	require.NoError(t, err)
+	require.Equal(t, "uuid-Etho", uuid)
+
+	_, err = cache.UUID(context.Background(), "ghost")
+	require.Error(t, err)
+
+	// both lookups are cached
+	now = now.Add(time.Minute)
+	uuid, err = cache.UUID(context.Background(), "Etho")
+	require.NoError(t, err)
+	require.Equal(t, "uuid-Etho", uuid)
+	uuid, err = cache.UUID(context.Background(), "ghost")
+	require.NoError(t, err)
+	require.Empty(t, uuid)
+	require.Equal(t, map[string]int{"Etho": 1, "ghost": 1}, lookups)
+
+	// failures are retried sooner than successes
+	now = now.Add(uuidFailureTTL)
+	_, _ = cache.UUID(context.Background(), "Etho")
+	_, _ = cache.UUID(context.Background(), "ghost")
+	require.Equal(t, map[string]int{"Etho": 1, "ghost": 2}, lookups)
+
+	now = now.Add(uuidTTL)
+	_, _ = cache.UUID(context.Background(), "Etho")
+	require.Equal(t, map[string]int{"Etho": 2, "ghost": 2}, lookups)
+}
+
+func TestHTTPUUIDResolver(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/profiles/minecraft/notch":
+			_, _ = w.Write([]byte(`{"id":"069A79F444E94726A5BEFCA90E38AAF5","name":"Notch"}`))
+		case "/users/profiles/minecraft/broken":
+			_, _ = w.Write([]byte(`{"id":`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer ts.Close()
+
+	resolve := httpUUIDResolver(ts.URL+"/users/profiles/minecraft/", time.Second)
+
+	uuid, err := resolve(context.Background(), "notch")
+	require.NoError(t, err)
+	require.Equal(t, "069a79f444e94726a5befca90e38aaf5", uuid)
+
+	_, err = resolve(context.Background(), "ghost")
+	require.EqualError(t, err, `lookup "ghost": 204 No Content`)
+
+	_, err = resolve(context.Background(), "broken")
+	require.Error(t, err)
+}
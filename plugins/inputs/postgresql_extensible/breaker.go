@@ -0,0 +1,66 @@
+package postgresqlextensible
+
+import (
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+)
+
+// breaker pauses a query after a number of consecutive failures. Once the
+// cooldown has elapsed the query is retried, a success closes the breaker
+// while a failure pauses the query for another cooldown.
+type breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	log       cua.Logger
+	now       func() time.Time
+
+	failures  int
+	open      bool
+	openUntil time.Time
+}
+
+func newBreaker(name string, threshold int, cooldown time.Duration, log cua.Logger) *breaker {
+	return &breaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		log:       log,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether the query may be run.
+func (b *breaker) allow() bool {
+	if !b.open {
+		return true
+	}
+	if b.now().Before(b.openUntil) {
+		return false
+	}
+	b.log.Infof("Query %q cooldown elapsed, retrying", b.name)
+	return true
+}
+
+// success records a successful run of the query.
+func (b *breaker) success() {
+	if b.open {
+		b.log.Infof("Query %q recovered, resuming", b.name)
+	}
+	b.failures = 0
+	b.open = false
+}
+
+// failure records a failed run of the query.
+func (b *breaker) failure() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.failures++
+	if b.open || b.failures >= b.threshold {
+		b.open = true
+		b.openUntil = b.now().Add(b.cooldown)
+		b.log.Warnf("Query %q failed %d consecutive times, pausing for %s", b.name, b.failures, b.cooldown)
+	}
+}
@@ -0,0 +1,59 @@
+package postgresqlextensible
+
+import (
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBreaker("SELECT 1", 3, time.Minute, testutil.Logger{})
+	b.now = func() time.Time { return now }
+
+	// closed, failures below the threshold keep running the query
+	for i := 0; i < 2; i++ {
+		require.True(t, b.allow())
+		b.failure()
+	}
+	require.True(t, b.allow())
+
+	// open after the threshold is reached
+	b.failure()
+	require.False(t, b.allow())
+	now = now.Add(30 * time.Second)
+	require.False(t, b.allow())
+
+	// retried once the cooldown elapsed, a failure pauses it again
+	now = now.Add(30 * time.Second)
+	require.True(t, b.allow())
+	b.failure()
+	require.False(t, b.allow())
+
+	// recovery closes the breaker
+	now = now.Add(time.Minute)
+	require.True(t, b.allow())
+	b.success()
+	require.True(t, b.allow())
+	b.failure()
+	require.True(t, b.allow())
+}
+
+func TestBreakerSuccessResets(t *testing.T) {
+	b := newBreaker("SELECT 1", 2, time.Minute, testutil.Logger{})
+
+	b.failure()
+	b.success()
+	b.failure()
+	require.True(t, b.allow())
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := newBreaker("SELECT 1", 0, time.Minute, testutil.Logger{})
+	for i := 0; i < 10; i++ {
+		b.failure()
+		require.True(t, b.allow())
+	}
+}
@@ -0,0 +1,105 @@
+package postgresqlextensible
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/internal"
+	"github.com/jackc/pgx"
+)
+
+// listenReconnectDelay is the time waited before listening again after the
+// listening connection failed.
+const listenReconnectDelay = 5 * time.Second
+
+// notificationListener receives the notifications of a LISTEN, it is
+// implemented by *pgx.Conn.
+type notificationListener interface {
+	Listen(channel string) error
+	WaitForNotification(ctx context.Context) (*pgx.Notification, error)
+	Close() error
+}
+
+// startListening listens for notifications on the listen channel, running a
+// gather on each of them in addition to the interval collection. The gathers
+// are run one at a time, notifications arriving while a gather is pending
+// are coalesced into it.
+func (p *Postgresql) startListening(ctx context.Context, acc cua.Accumulator) {
+	lctx, cancel := context.WithCancel(ctx)
+	p.cancelListen = cancel
+	trigger := make(chan struct{}, 1)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for lctx.Err() == nil {
+			err := p.listen(lctx, trigger)
+			if err != nil && lctx.Err() == nil {
+				acc.AddError(fmt.Errorf("listen on %s: %w", p.ListenChannel, err))
+				_ = internal.SleepContext(lctx, listenReconnectDelay)
+			}
+		}
+	}()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for {
+			select {
+			case <-lctx.Done():
+				return
+			case <-trigger:
+				acc.AddError(p.Gather(lctx, acc))
+			}
+		}
+	}()
+}
+
+// listen issues LISTEN on a connection of its own and signals trigger on
+// every notification until the connection fails or ctx is done.
+func (p *Postgresql) listen(ctx context.Context, trigger chan<- struct{}) error {
+	newListener := p.newListener
+	if newListener == nil {
+		newListener = p.connectListener
+	}
+	l, err := newListener()
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	if err := l.Listen(p.ListenChannel); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	for {
+		n, err := l.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait for notification: %w", err)
+		}
+		p.Log.Debugf("Notification on %s: %q", n.Channel, n.Payload)
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// connectListener connects to the address in use, notifications need a
+// connection held for their whole lifetime which the pool can't provide.
+func (p *Postgresql) connectListener() (notificationListener, error) {
+	p.mu.Lock()
+	address := p.Address
+	p.mu.Unlock()
+
+	config, err := pgx.ParseConnectionString(address)
+	if err != nil {
+		return nil, fmt.Errorf("parse address: %w", err)
+	}
+	conn, err := pgx.Connect(config)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,95 @@
+package postgresqlextensible
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/circonus-labs/circonus-unified-agent/plugins/inputs/postgresql"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeListener struct {
+	channels      chan string
+	notifications chan *pgx.Notification
+}
+
+func (f *fakeListener) Listen(channel string) error {
+	f.channels <- channel
+	return nil
+}
+
+func (f *fakeListener) WaitForNotification(ctx context.Context) (*pgx.Notification, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case n, ok := <-f.notifications:
+		if !ok {
+			return nil, errors.New("connection closed")
+		}
+		return n, nil
+	}
+}
+
+func (f *fakeListener) Close() error {
+	return nil
+}
+
+func TestListenNotificationGathers(t *testing.T) {
+	listener := &fakeListener{
+		channels:      make(chan string, 1),
+		notifications: make(chan *pgx.Notification),
+	}
+	p := &Postgresql{
+		Log: testutil.Logger{},
+		Service: postgresql.Service{
+			Address:       "host=127.0.0.1 port=1 user=postgres sslmode=disable connect_timeout=2",
+			Outputaddress: "db01",
+		},
+		ListenChannel: "events",
+		IgnoreVersion: true,
+		newListener: func() (notificationListener, error) {
+			return listener, nil
+		},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, p.Init())
+	require.NoError(t, p.Start(context.Background(), &acc))
+	require.Equal(t, "events", <-listener.channels)
+	require.Equal(t, uint64(0), acc.NMetrics())
+
+	listener.notifications <- &pgx.Notification{Channel: "events", Payload: "orders"}
+	acc.Wait(1)
+	m := collectorMetric(t, &acc)
+	require.Equal(t, map[string]string{"server": "db01"}, m.Tags)
+
+	// the interval collection still gathers
+	require.NoError(t, p.Gather(context.Background(), &acc))
+	acc.Wait(2)
+
+	p.Stop()
+	require.NoError(t, acc.FirstError())
+}
+
+func TestListenReportsErrors(t *testing.T) {
+	p := &Postgresql{
+		Log: testutil.Logger{},
+		Service: postgresql.Service{
+			Address: "host=127.0.0.1 port=1 user=postgres sslmode=disable connect_timeout=2",
+		},
+		ListenChannel: "events",
+		newListener: func() (notificationListener, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, p.Init())
+	require.NoError(t, p.Start(context.Background(), &acc))
+	acc.WaitError(1)
+	p.Stop()
+	require.EqualError(t, acc.FirstError(), "listen on events: connection refused")
+}
@@ -3,35 +3,105 @@ package postgresqlextensible
 import (
 	"bytes"
 	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/circonus-labs/circonus-unified-agent/cua"
 	"github.com/circonus-labs/circonus-unified-agent/internal"
 	"github.com/circonus-labs/circonus-unified-agent/plugins/inputs"
 	"github.com/circonus-labs/circonus-unified-agent/plugins/inputs/postgresql"
+	"github.com/jackc/pgx"
 	_ "github.com/jackc/pgx/stdlib" //nolint:golint
 )
 
 type Postgresql struct {
 	postgresql.Service
-	Databases      []string
-	AdditionalTags []string
-	Query          query
-	Debug          bool
+	Databases        []string
+	Query            query
+	Debug            bool
+	StatementTimeout internal.Duration `toml:"statement_timeout"`
+	ApplicationName  string            `toml:"application_name"`
+	CollectDBSize    bool              `toml:"collect_db_size"`
+	FailureThreshold int               `toml:"failure_threshold"`
+	Cooldown         internal.Duration `toml:"cooldown"`
+	Addresses        []string          `toml:"addresses"`
+	IgnoreVersion    bool              `toml:"ignore_version"`
+	SSLCert          string            `toml:"sslcert"`
+	SSLKey           string            `toml:"sslkey"`
+	SSLRootCert      string            `toml:"sslrootcert"`
+	UnsupportedTypes string            `toml:"unsupported_types"`
+	ListenChannel    string            `toml:"listen_channel"`
 
 	Log cua.Logger
+
+	// addresses are the address followed by the fallback addresses, with the
+	// connection options applied.
+	addresses []string
+	// configured maps the addresses with the connection options applied to
+	// the addresses as configured, which the server tag is computed from.
+	configured map[string]string
+	ping       func(ctx context.Context) error
+
+	breakers []*breaker
+
+	// dbVersion caches the server version detected on the current
+	// connection, zero means it has to be detected again.
+	dbVersion    int
+	queryVersion func(ctx context.Context) (int, error)
+
+	// mu serializes the gathers of the interval and of the notifications.
+	mu           sync.Mutex
+	newListener  func() (notificationListener, error)
+	cancelListen context.CancelFunc
+	wg           sync.WaitGroup
 }
 
-type query []struct {
+type query []queryConfig
+
+type queryConfig struct {
 	Sqlquery    string
 	Script      string
 	Version     int
 	Withdbname  bool
 	Tagvalue    string
 	Measurement string
+	FieldTypes  map[string]string `toml:"field_types"`
+	ColumnMap   map[string]string `toml:"column_map"`
+	Timeout     internal.Duration `toml:"timeout"`
+	MaxRows     int               `toml:"max_rows"`
+	FieldPrefix string            `toml:"field_prefix"`
+	PerDatabase bool              `toml:"per_database"`
+	ExpandEnv   bool              `toml:"expand_env"`
+
+	// statsID identifies the query in the query stats by its index in the
+	// configuration, followed by the index of the statement for scripts with
+	// several statements.
+	statsID string
+}
+
+// tagColumns returns the names of the columns listed in Tagvalue which are
+// emitted as tags instead of fields, each name once.
+func (q *queryConfig) tagColumns() []string {
+	if q.Tagvalue == "" {
+		return nil
+	}
+	var cols []string
+	for _, col := range strings.Split(q.Tagvalue, ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			cols = append(cols, col)
+		}
+	}
+	return internal.Dedup(cols)
 }
 
 var ignoredColumns = map[string]bool{"stats_reset": true}
@@ -53,6 +123,49 @@ var sampleConfig = `
   #
   address = "host=localhost user=postgres sslmode=disable"
 
+  ## Client certificate, key and root certificate for ssl authentication,
+  ## added to the address unless it already sets them.
+  # sslcert = "/etc/cua/postgresql.crt"
+  # sslkey = "/etc/cua/postgresql.key"
+  # sslrootcert = "/etc/cua/root.crt"
+
+  ## How to handle columns whose type can't be a field, ie, timestamps,
+  ## arrays or json: "drop" the field, convert it to a "string" (timestamps
+  ## as RFC3339, other values as json) or fail the query with an "error".
+  # unsupported_types = "drop"
+
+  ## Fallback addresses, ie, read replicas, tried in order when the address
+  ## does not accept a connection. The "server" tag reflects the address in
+  ## use unless outputaddress is set.
+  # addresses = ["host=replica1 user=postgres sslmode=disable"]
+
+  ## Also gather whenever a notification is sent on this channel with
+  ## NOTIFY, in addition to the interval collection. A connection is kept
+  ## open to LISTEN on the channel.
+  # listen_channel = ""
+
+  ## Run every query regardless of its version, without detecting the server
+  ## version. Useful when pg_settings is not readable by the user. With
+  ## fallback addresses the server is pinged instead to fail over.
+  # ignore_version = false
+
+  ## Server side statement timeout and application name for the connection.
+  ## Both may also be given as query parameters of an address url, ie,
+  ##   postgres://localhost/postgres?statement_timeout=5s&application_name=cua
+  ## or as options of a key/value address, which then set these options for
+  ## every address. Conflicting values are an error.
+  # statement_timeout = "0s"
+  # application_name = ""
+
+  ## Emit the size of each database (or of those listed in databases) as the
+  ## db_size_bytes field without needing a custom query.
+  # collect_db_size = false
+
+  ## Pause a query for the cooldown period after it failed failure_threshold
+  ## consecutive times, a threshold of 0 never pauses queries.
+  # failure_threshold = 0
+  # cooldown = "5m"
+
   ## connection configuration.
   ## maxlifetime - specify the maximum lifetime of a connection.
   ## default is forever (0s)
@@ -73,9 +186,9 @@ var sampleConfig = `
   ## 'is not null' in order to make the query succeed.
   ## Example :
   ## The sqlquery : "SELECT * FROM pg_stat_database where datname" become
-  ## "SELECT * FROM pg_stat_database where datname IN ('postgres', 'pgbench')"
-  ## because the databases variable was set to ['postgres', 'pgbench' ] and the
-  ## withdbname was true. Be careful that if the withdbname is set to false you
+  ## "SELECT * FROM pg_stat_database where datname IN ($1, $2)" with 'postgres'
+  ## and 'pgbench' passed as the query arguments because the databases variable
+  ## was set to ['postgres', 'pgbench' ] and the withdbname was true. Be careful that if the withdbname is set to false you
   ## don't have to define the where clause (aka with the dbname) the tagvalue
   ## field is used to define custom tags (separated by commas)
   ## The optional "measurement" value can be used to override the default
@@ -83,6 +196,8 @@ var sampleConfig = `
   ##
   ## The script option can be used to specify the .sql file path.
   ## If script and sqlquery options specified at same time, sqlquery will be used 
+  ## Comments are stripped from scripts, a script with several semicolon
+  ## separated statements runs each of them as a query with the same options.
   ##
   ## Structure :
   ## [[inputs.postgresql_extensible.query]]
@@ -91,6 +206,17 @@ var sampleConfig = `
   ##   withdbname boolean
   ##   tagvalue string (comma separated)
   ##   measurement string
+  ##   timeout duration after which the query is cancelled (default none)
+  ##   max_rows maximum number of rows processed per interval (default unlimited)
+  ##   field_prefix string prepended to the name of every field (default none)
+  ##   expand_env boolean, expand ${VAR} and $VAR environment variables in the
+  ##     script, "$$" is a literal "$" (default false)
+  ##   per_database boolean, with withdbname run the query once for each of the
+  ##     databases, comparing datname with "= $1" and tagging the rows with
+  ##     the database as db (default false)
+  ##   field_types table of column name to type (int, float, string or bool)
+  ##   column_map table of column name to the name of its field, the other
+  ##     options still refer to the column name (default none)
   [[inputs.postgresql_extensible.query]]
     sqlquery="SELECT * FROM pg_stat_database"
     version=901
@@ -102,21 +228,254 @@ var sampleConfig = `
     version=901
     withdbname=false
     tagvalue="postgresql.stats"
+  ## Force the type of the emitted fields regardless of the type returned by
+  ## the driver, values which cannot be converted are logged and left as is.
+  #  [inputs.postgresql_extensible.query.field_types]
+  #    buffers_clean = "int"
+  ## Rename columns to friendlier field names, unmapped columns keep their
+  ## name.
+  #  [inputs.postgresql_extensible.query.column_map]
+  #    buffers_clean = "buffers_cleaned"
 `
 
 func (p *Postgresql) Init() error {
-	var err error
+	for _, cert := range p.certOptions() {
+		if cert[1] == "" {
+			continue
+		}
+		if _, err := os.Stat(cert[1]); err != nil {
+			return fmt.Errorf("%s: %w", cert[0], err)
+		}
+	}
+	switch p.UnsupportedTypes {
+	case "":
+		p.UnsupportedTypes = "drop"
+	case "drop", "string", "error":
+	default:
+		return fmt.Errorf("invalid unsupported_types %q, must be drop, string or error", p.UnsupportedTypes)
+	}
+	if err := p.optionsFromAddresses(); err != nil {
+		return err
+	}
+	if err := p.applyAddressOptions(); err != nil {
+		return err
+	}
+	if len(p.Addresses) > 0 {
+		primary := p.Address
+		p.addresses = []string{primary}
+		for _, addr := range p.Addresses {
+			p.Address = addr
+			if err := p.applyAddressOptions(); err != nil {
+				return err
+			}
+			p.addresses = append(p.addresses, p.Address)
+		}
+		p.Address = primary
+	}
+	queries := make(query, 0, len(p.Query))
 	for i := range p.Query {
-		if p.Query[i].Sqlquery == "" {
-			p.Query[i].Sqlquery, err = ReadQueryFromFile(p.Query[i].Script)
+		for col, typ := range p.Query[i].FieldTypes {
+			if !validFieldTypes[typ] {
+				return fmt.Errorf("invalid field type %q for column %q", typ, col)
+			}
+		}
+		if p.Query[i].PerDatabase && !p.Query[i].Withdbname {
+			return fmt.Errorf("per_database requires withdbname for query %q", p.Query[i].Sqlquery+p.Query[i].Script)
+		}
+		p.Query[i].statsID = strconv.Itoa(i)
+		if p.Query[i].Sqlquery != "" {
+			queries = append(queries, p.Query[i])
+			continue
+		}
+		// every statement of a script runs as a query of its own
+		statements, err := readStatementsFromFile(p.Query[i].Script, p.Query[i].ExpandEnv)
+		if err != nil {
+			return err
+		}
+		for n, stmt := range statements {
+			q := p.Query[i]
+			q.Sqlquery = stmt
+			if len(statements) > 1 {
+				q.statsID += "_" + strconv.Itoa(n)
+			}
+			queries = append(queries, q)
+		}
+	}
+	p.Query = queries
+
+	p.breakers = make([]*breaker, len(p.Query))
+	for i := range p.Query {
+		p.breakers[i] = newBreaker(p.Query[i].Sqlquery, p.FailureThreshold, p.Cooldown.Duration, p.Log)
+	}
+	return nil
+}
+
+// certOptions returns the name and value of the client certificate options.
+func (p *Postgresql) certOptions() [][2]string {
+	return [][2]string{{"sslcert", p.SSLCert}, {"sslkey", p.SSLKey}, {"sslrootcert", p.SSLRootCert}}
+}
+
+// optionsFromAddresses sets the statement_timeout and application_name
+// options from the query parameters of the address urls, or the options of
+// key/value addresses, which set them. A value conflicting with the option or
+// with another address is an error, so that every address connects with the
+// same options.
+func (p *Postgresql) optionsFromAddresses() error {
+	for _, address := range append([]string{p.Address}, p.Addresses...) {
+		if address == "" || address == "localhost" {
+			continue
+		}
+		options, err := addressOptions(address)
+		if err != nil {
+			return err
+		}
+
+		if v, ok := options["application_name"]; ok {
+			if p.ApplicationName != "" && p.ApplicationName != v {
+				return fmt.Errorf("application_name %q of an address conflicts with %q", v, p.ApplicationName)
+			}
+			p.ApplicationName = v
+		}
+
+		if v, ok := options["statement_timeout"]; ok {
+			timeout, err := parseStatementTimeout(v)
 			if err != nil {
 				return err
 			}
+			if p.StatementTimeout.Duration != 0 && p.StatementTimeout.Duration != timeout {
+				return fmt.Errorf("statement_timeout %q of an address conflicts with %s", v, p.StatementTimeout.Duration)
+			}
+			p.StatementTimeout.Duration = timeout
 		}
 	}
 	return nil
 }
 
+// addressOptions returns the query parameters of an address url, or the
+// options of a key/value address.
+func addressOptions(address string) (map[string]string, error) {
+	if !strings.HasPrefix(address, "postgres://") && !strings.HasPrefix(address, "postgresql://") {
+		options, err := internal.ParseKVString(address)
+		if err != nil {
+			return nil, fmt.Errorf("address: %w", err)
+		}
+		return options, nil
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("url parse: %w", err)
+	}
+	params := u.Query()
+	options := make(map[string]string, len(params))
+	for key := range params {
+		options[key] = params.Get(key)
+	}
+	return options, nil
+}
+
+// parseStatementTimeout parses a statement_timeout of an address, postgres
+// interprets a bare number as milliseconds.
+func parseStatementTimeout(v string) (time.Duration, error) {
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("statement_timeout (%s): %w", v, err)
+	}
+	return d, nil
+}
+
+// applyAddressOptions writes the connection options of the plugin, which
+// optionsFromAddresses reconciled with the addresses, back to the address so
+// they are sent to the server when connecting. The server tag is still
+// computed from the address as configured. The client certificate options
+// are only added when the address doesn't set them.
+func (p *Postgresql) applyAddressOptions() error {
+	if p.Address == "" || p.Address == "localhost" {
+		// the default address of the service, spelled out so the options
+		// can be added to it
+		p.Address = "host=localhost sslmode=disable"
+	}
+
+	address, err := p.addAddressOptions(p.Address)
+	if err != nil {
+		return err
+	}
+	if p.configured == nil {
+		p.configured = make(map[string]string)
+	}
+	p.configured[address] = p.Address
+	p.Address = address
+	return nil
+}
+
+// addAddressOptions returns the address with the connection options of the
+// plugin added to it.
+func (p *Postgresql) addAddressOptions(address string) (string, error) {
+	certs := p.certOptions()
+
+	if !strings.HasPrefix(address, "postgres://") && !strings.HasPrefix(address, "postgresql://") {
+		// parsed rather than searched, a value like a password may contain
+		// the name of an option
+		options, err := internal.ParseKVString(address)
+		if err != nil {
+			return "", fmt.Errorf("address: %w", err)
+		}
+		if p.ApplicationName != "" && options["application_name"] != p.ApplicationName {
+			address += " application_name='" + strings.ReplaceAll(p.ApplicationName, "'", `\'`) + "'"
+		}
+		if p.StatementTimeout.Duration > 0 {
+			// the address may spell the same timeout differently, ie, 5s,
+			// and a key given twice keeps its last value
+			timeout := strconv.FormatInt(p.StatementTimeout.Duration.Milliseconds(), 10)
+			if options["statement_timeout"] != timeout {
+				address += " statement_timeout=" + timeout
+			}
+		}
+		for _, cert := range certs {
+			if _, ok := options[cert[0]]; cert[1] != "" && !ok {
+				address += " " + cert[0] + "='" + strings.ReplaceAll(cert[1], "'", `\'`) + "'"
+			}
+		}
+		return address, nil
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", fmt.Errorf("url parse: %w", err)
+	}
+	params := u.Query()
+
+	if p.ApplicationName != "" {
+		params.Set("application_name", p.ApplicationName)
+	}
+	if p.StatementTimeout.Duration > 0 {
+		params.Set("statement_timeout", strconv.FormatInt(p.StatementTimeout.Duration.Milliseconds(), 10))
+	}
+	for _, cert := range certs {
+		if cert[1] != "" && params.Get(cert[0]) == "" {
+			params.Set(cert[0], cert[1])
+		}
+	}
+
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
+
+// SanitizedAddress returns the address in use as configured, without the
+// connection options added to it, sanitized, so that the options don't
+// change the server tag.
+func (p *Postgresql) SanitizedAddress() (string, error) {
+	address, ok := p.configured[p.Address]
+	if !ok {
+		return p.Service.SanitizedAddress()
+	}
+	s := postgresql.Service{Address: address, Outputaddress: p.Outputaddress}
+	return s.SanitizedAddress()
+}
+
 func (p *Postgresql) SampleConfig() string {
 	return sampleConfig
 }
@@ -140,83 +499,416 @@ func ReadQueryFromFile(filePath string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("readall (%s): %w", filePath, err)
 	}
-	return string(query), nil
+	return string(internal.StripBOM(query)), nil
+}
+
+// readStatementsFromFile reads a sql script, returning its statements with
+// the comments removed. With expandEnv the environment variables referenced
+// by the script are expanded before it is split, so that "$$" is a literal
+// "$" rather than a dollar quote, references to unset variables are kept so
+// the statement fails instead of silently running without them.
+func readStatementsFromFile(filePath string, expandEnv bool) ([]string, error) {
+	script, err := ReadQueryFromFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if expandEnv {
+		script = internal.EnvSubstKeepUnset(script)
+	}
+	statements := splitStatements(script)
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("no statements in %s", filePath)
+	}
+	return statements, nil
+}
+
+// Start connects to the server, forgetting the version detected on any
+// previous connection, and listens for notifications when configured.
+func (p *Postgresql) Start(ctx context.Context, acc cua.Accumulator) error {
+	p.dbVersion = 0
+	var err error
+	if len(p.addresses) == 0 {
+		err = p.Service.Start(ctx, acc)
+	} else {
+		err = p.connect(ctx, acc)
+	}
+	if err != nil || p.ListenChannel == "" {
+		return err
+	}
+	p.startListening(ctx, acc)
+	return nil
+}
+
+// Stop stops listening for notifications and closes the connections.
+func (p *Postgresql) Stop() {
+	if p.cancelListen != nil {
+		p.cancelListen()
+		p.wg.Wait()
+	}
+	p.Service.Stop()
+}
+
+// connectTimeout bounds each connection attempt when failing over between
+// addresses.
+const connectTimeout = 5 * time.Second
+
+// connect starts the service on the first address accepting a connection.
+// When none does the primary address is used, so that the next collection
+// reports the failure and tries the addresses again.
+func (p *Postgresql) connect(ctx context.Context, acc cua.Accumulator) error {
+	// the server of another address may run another version
+	p.dbVersion = 0
+	for _, addr := range p.addresses {
+		p.Address = addr
+		if err := p.Service.Start(ctx, acc); err != nil {
+			return err
+		}
+		sanitized, _ := p.SanitizedAddress()
+
+		err := p.pingServer(ctx)
+		if err == nil {
+			p.Log.Infof("Connected to %s", sanitized)
+			return nil
+		}
+		p.Log.Warnf("Connecting to %s failed: %s", sanitized, err)
+		p.Service.Stop()
+	}
+
+	p.Address = p.addresses[0]
+	return p.Service.Start(ctx, acc)
+}
+
+// pingServer checks the server of the address in use is reachable.
+func (p *Postgresql) pingServer(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	if p.ping != nil {
+		return p.ping(ctx)
+	}
+	return p.DB.PingContext(ctx)
 }
 
 func (p *Postgresql) Gather(ctx context.Context, acc cua.Accumulator) error {
-	var (
-		err        error
-		sqlQuery   string
-		queryAddon string
-		dbVersion  int
-		query      string
-		tagValue   string
-		measName   string
-		columns    []string
-	)
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	// Retrieving the database version
-	query = `SELECT setting::integer / 100 AS version FROM pg_settings WHERE name = 'server_version_num'`
-	if err = p.DB.QueryRow(query).Scan(&dbVersion); err != nil {
-		dbVersion = 0
+	var queriesRun, queryErrors int
+	start := time.Now()
+
+	// the server is checked by detecting its version, or by pinging it
+	// when the version is ignored and there are addresses to fail over to
+	var dbVersion int
+	check := func() (err error) {
+		if p.IgnoreVersion {
+			return p.pingServer(ctx)
+		}
+		dbVersion, err = p.version(ctx)
+		return err
+	}
+	if !p.IgnoreVersion || len(p.addresses) > 0 {
+		err := check()
+		if err != nil && len(p.addresses) > 0 {
+			// the server went away, fail over to the next reachable address
+			p.Service.Stop()
+			if err = p.connect(ctx, acc); err == nil {
+				err = check()
+			}
+		}
+		switch {
+		case err == nil:
+		case p.IgnoreVersion:
+			p.Log.Warnf("Connecting to the server failed: %s", err)
+			queryErrors++
+		default:
+			p.Log.Warnf("Detecting the server version failed, skipping queries with a version: %s", err)
+			queryErrors++
+		}
 	}
 
 	// We loop in order to process each query
 	// Query is not run if Database version does not match the query version.
 	for i := range p.Query {
-		sqlQuery = p.Query[i].Sqlquery
-		tagValue = p.Query[i].Tagvalue
+		if (!p.IgnoreVersion && p.Query[i].Version > dbVersion) || !p.breakers[i].allow() {
+			continue
+		}
+		queriesRun++
+		if !p.gatherQuery(ctx, acc, i) {
+			queryErrors++
+		}
+	}
 
-		if p.Query[i].Measurement != "" {
-			measName = p.Query[i].Measurement
-		} else {
-			measName = "postgresql"
+	if p.CollectDBSize {
+		queriesRun++
+		if err := p.gatherDBSize(ctx, acc); err != nil {
+			p.Log.Error(err.Error())
+			queryErrors++
 		}
+	}
+
+	p.accCollector(acc, queriesRun, queryErrors, time.Since(start))
+	return nil
+}
+
+// accCollector emits the health of the collection itself, so an unreachable
+// server can be told apart from queries returning no rows.
+func (p *Postgresql) accCollector(acc cua.Accumulator, queriesRun, queryErrors int, elapsed time.Duration) {
+	tagAddress, err := p.SanitizedAddress()
+	if err != nil {
+		p.Log.Errorf("sanitize addr: %s", err)
+		return
+	}
+	fields := map[string]interface{}{
+		"queries_run":        int64(queriesRun),
+		"query_errors":       int64(queryErrors),
+		"gather_duration_ms": float64(elapsed) / float64(time.Millisecond),
+	}
+	acc.AddFields("postgresql_collector", fields, map[string]string{"server": tagAddress})
+}
 
-		if p.Query[i].Withdbname {
-			if len(p.Databases) != 0 {
-				queryAddon = fmt.Sprintf(` IN ('%s')`,
-					strings.Join(p.Databases, "','"))
-			} else {
-				queryAddon = " is not null"
+// accQueryStats emits how long the i-th query took and how many rows it
+// returned, identified by its measurement name and configuration index.
+func (p *Postgresql) accQueryStats(acc cua.Accumulator, i int, measName string, elapsed time.Duration, rowCount int) {
+	tagAddress, err := p.SanitizedAddress()
+	if err != nil {
+		p.Log.Errorf("sanitize addr: %s", err)
+		return
+	}
+	fields := map[string]interface{}{
+		"duration_ms": float64(elapsed) / float64(time.Millisecond),
+		"row_count":   int64(rowCount),
+	}
+	tags := map[string]string{
+		"server": tagAddress,
+		"query":  measName + "_" + p.Query[i].statsID,
+	}
+	acc.AddFields("postgresql_query_stats", fields, tags)
+}
+
+// version returns the server version, only querying the server when no
+// version is cached for the current connection.
+func (p *Postgresql) version(ctx context.Context) (int, error) {
+	if p.dbVersion != 0 {
+		return p.dbVersion, nil
+	}
+	queryVersion := p.queryVersion
+	if queryVersion == nil {
+		queryVersion = p.queryServerVersion
+	}
+	v, err := queryVersion(ctx)
+	if err != nil {
+		return 0, err
+	}
+	p.dbVersion = v
+	return v, nil
+}
+
+func (p *Postgresql) queryServerVersion(ctx context.Context) (int, error) {
+	var v int
+	query := `SELECT setting::integer / 100 AS version FROM pg_settings WHERE name = 'server_version_num'`
+	if err := p.DB.QueryRowContext(ctx, query).Scan(&v); err != nil {
+		return 0, fmt.Errorf("server version: %w", err)
+	}
+	return v, nil
+}
+
+// gatherQuery runs the i-th query, releasing its result set and connection
+// before returning so that queries do not hold connections for the whole
+// collection cycle. It returns false when the query failed.
+func (p *Postgresql) gatherQuery(gatherCtx context.Context, acc cua.Accumulator, i int) bool {
+	measName := internal.FirstNonEmpty(p.Query[i].Measurement, "postgresql")
+
+	ctx := gatherCtx
+	if p.Query[i].Timeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(gatherCtx, p.Query[i].Timeout.Duration)
+		defer cancel()
+	}
+
+	// the stats cover running the query and reading its rows
+	start := time.Now()
+	rowCount := 0
+	defer func() {
+		p.accQueryStats(acc, i, measName, time.Since(start), rowCount)
+	}()
+
+	ok := true
+	for _, run := range p.queryRuns(&p.Query[i]) {
+		n, rowsOK, err := p.runQuery(gatherCtx, ctx, acc, i, measName, run)
+		rowCount += n
+		if err != nil {
+			p.logQueryError(gatherCtx, ctx, i, err)
+			p.breakers[i].failure()
+			if isConnectionError(err) {
+				// the server went away and may be another one once the
+				// connection is re-established, so detect the version again
+				p.dbVersion = 0
 			}
-		} else {
-			queryAddon = ""
+			return false
 		}
-		sqlQuery += queryAddon
+		ok = ok && rowsOK
+	}
+	p.breakers[i].success()
+	return ok
+}
 
-		if p.Query[i].Version <= dbVersion {
-			rows, err := p.DB.Query(sqlQuery)
-			if err != nil {
-				p.Log.Error(err.Error())
-				continue
-			}
+// isConnectionError reports whether err comes from the connection to the
+// server rather than from the server rejecting the query, ie, a missing table
+// or a permission error.
+func isConnectionError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		// the query timed out or the gather was cancelled
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, pgx.ErrDeadConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
 
-			defer rows.Close()
+// queryRun is a single execution of a query, db is the database the rows are
+// tagged with when the query runs once per database.
+type queryRun struct {
+	sql  string
+	args []interface{}
+	db   string
+}
 
-			// grab the column information from the result
-			if columns, err = rows.Columns(); err != nil {
-				p.Log.Error(err.Error())
-				continue
-			}
+// queryRuns returns the executions of a query: one per database for per
+// database queries, a single one otherwise.
+func (p *Postgresql) queryRuns(q *queryConfig) []queryRun {
+	if !q.PerDatabase || len(p.Databases) == 0 {
+		sql, args := p.buildQuery(q)
+		return []queryRun{{sql: sql, args: args}}
+	}
+	runs := make([]queryRun, len(p.Databases))
+	for i, db := range p.Databases {
+		runs[i] = queryRun{sql: q.Sqlquery + " = $1", args: []interface{}{db}, db: db}
+	}
+	return runs
+}
 
-			p.AdditionalTags = nil
-			if tagValue != "" {
-				tagList := strings.Split(tagValue, ",")
-				for t := range tagList {
-					p.AdditionalTags = append(p.AdditionalTags, tagList[t])
-				}
-			}
+// runQuery executes a run of the i-th query within ctx, derived from the
+// context of the gather, and accumulates its rows. It returns the number of
+// rows accumulated, whether they were read without errors, which are logged,
+// and the error of the query itself.
+func (p *Postgresql) runQuery(gatherCtx, ctx context.Context, acc cua.Accumulator, i int, measName string, run queryRun) (int, bool, error) {
+	rows, err := p.DB.QueryContext(ctx, run.sql, run.args...)
+	if err != nil {
+		return 0, false, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
 
-			for rows.Next() {
-				err = p.accRow(measName, rows, acc, columns)
-				if err != nil {
-					p.Log.Error(err.Error())
-					break
-				}
-			}
+	// grab the column information from the result
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, false, fmt.Errorf("columns: %w", err)
+	}
+
+	ok := true
+	rowCount, err := p.accRows(&p.Query[i], measName, run.db, rows, acc, columns)
+	if err != nil {
+		p.Log.Error(err.Error())
+		ok = false
+	}
+	if err := rows.Err(); err != nil {
+		p.logQueryError(gatherCtx, ctx, i, err)
+		ok = false
+	}
+	return rowCount, ok, nil
+}
+
+// logQueryError logs the error of the i-th query run within ctx, calling out
+// queries which were cancelled because they exceeded their own timeout or
+// because the whole gather was cancelled.
+func (p *Postgresql) logQueryError(gatherCtx, ctx context.Context, i int, err error) {
+	switch {
+	case gatherCtx.Err() != nil:
+		p.Log.Errorf("Query %q cancelled with the gather: %s", p.Query[i].Sqlquery, err)
+	case p.Query[i].Timeout.Duration > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		p.Log.Errorf("Query %q cancelled after exceeding its timeout of %s: %s", p.Query[i].Sqlquery, p.Query[i].Timeout.Duration, err)
+	default:
+		p.Log.Error(err.Error())
+	}
+}
+
+// dbSizeQuery returns the query and its arguments used to collect the size
+// of the configured databases, or of all non template databases.
+func (p *Postgresql) dbSizeQuery() (string, []interface{}) {
+	query := `SELECT datname, pg_database_size(datname) FROM pg_database WHERE NOT datistemplate`
+	if len(p.Databases) == 0 {
+		return query, nil
+	}
+
+	clause, args := databasesIn(p.Databases)
+	return query + " AND datname" + clause, args
+}
+
+// buildQuery returns the sql of the query and its arguments. When the query
+// is run with the database names, the configured databases are passed as
+// arguments of an IN clause appended to the sql.
+func (p *Postgresql) buildQuery(q *queryConfig) (string, []interface{}) {
+	if !q.Withdbname {
+		return q.Sqlquery, nil
+	}
+	if len(p.Databases) == 0 {
+		return q.Sqlquery + " is not null", nil
+	}
+	clause, args := databasesIn(p.Databases)
+	return q.Sqlquery + clause, args
+}
+
+// databasesIn returns an IN clause matching the given databases with a
+// placeholder for each of them, and the databases as the query arguments.
+func databasesIn(databases []string) (string, []interface{}) {
+	params := make([]string, len(databases))
+	args := make([]interface{}, len(databases))
+	for i, db := range databases {
+		params[i] = "$" + strconv.Itoa(i+1)
+		args[i] = db
+	}
+	return " IN (" + strings.Join(params, ", ") + ")", args
+}
+
+func (p *Postgresql) gatherDBSize(ctx context.Context, acc cua.Accumulator) error {
+	query, args := p.dbSizeQuery()
+	rows, err := p.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("database size query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := p.accDBSize(rows, acc); err != nil {
+			return err
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("database size rows: %w", err)
+	}
+	return nil
+}
+
+func (p *Postgresql) accDBSize(row scanner, acc cua.Accumulator) error {
+	var (
+		dbname string
+		size   int64
+	)
+	if err := row.Scan(&dbname, &size); err != nil {
+		return fmt.Errorf("database size scan: %w", err)
+	}
+
+	tagAddress, err := p.SanitizedAddress()
+	if err != nil {
+		return fmt.Errorf("sanitize addr: %w", err)
+	}
+
+	tags := map[string]string{
+		"server": tagAddress,
+		"db":     dbname,
+	}
+	fields := map[string]interface{}{
+		"db_size_bytes": size,
+	}
+	acc.AddFields("postgresql", fields, tags)
 	return nil
 }
 
@@ -224,7 +916,36 @@ type scanner interface {
 	Scan(dest ...interface{}) error
 }
 
-func (p *Postgresql) accRow(measName string, row scanner, acc cua.Accumulator, columns []string) error {
+type rowIterator interface {
+	scanner
+	Next() bool
+}
+
+// accRows accumulates the rows of a query result, stopping after MaxRows
+// rows when the query sets a limit. The remaining rows are drained so the
+// number of skipped rows can be reported. The rows are tagged with db when it
+// is set. It returns the number of rows accumulated.
+func (p *Postgresql) accRows(q *queryConfig, measName, db string, rows rowIterator, acc cua.Accumulator, columns []string) (int, error) {
+	tagColumns := q.tagColumns()
+	processed := 0
+	for rows.Next() {
+		if q.MaxRows > 0 && processed >= q.MaxRows {
+			skipped := 1
+			for rows.Next() {
+				skipped++
+			}
+			p.Log.Warnf("Query %q reached max_rows limit of %d, skipped %d rows", q.Sqlquery, q.MaxRows, skipped)
+			return processed, nil
+		}
+		if err := p.accRow(q, measName, db, tagColumns, rows, acc, columns); err != nil {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+func (p *Postgresql) accRow(q *queryConfig, measName, db string, tagColumns []string, row scanner, acc cua.Accumulator, columns []string) error {
 	var (
 		err        error
 		columnVars []interface{}
@@ -249,7 +970,10 @@ func (p *Postgresql) accRow(measName string, row scanner, acc cua.Accumulator, c
 		return fmt.Errorf("row scan: %w", err)
 	}
 
-	if c, ok := columnMap["datname"]; ok && *c != nil {
+	if db != "" {
+		// the query ran for this database only
+		dbname.WriteString(db)
+	} else if c, ok := columnMap["datname"]; ok && *c != nil {
 		// extract the database name from the column map
 		switch datname := (*c).(type) {
 		case string:
@@ -280,7 +1004,7 @@ COLUMN:
 			continue
 		}
 
-		for _, tag := range p.AdditionalTags {
+		for _, tag := range tagColumns {
 			if col != tag {
 				continue
 			}
@@ -297,16 +1021,161 @@ COLUMN:
 			continue COLUMN
 		}
 
+		field := col
+		if name, ok := q.ColumnMap[col]; ok && name != "" {
+			field = name
+		}
+		field = q.FieldPrefix + field
 		if v, ok := (*val).([]byte); ok {
-			fields[col] = string(v)
+			fields[field] = string(v)
 		} else {
-			fields[col] = *val
+			fields[field] = *val
+		}
+
+		if typ, ok := q.FieldTypes[col]; ok {
+			v, err := coerceField(fields[field], typ)
+			if err != nil {
+				p.Log.Warnf("Failed to convert %q to %s: %s", col, typ, err)
+				continue
+			}
+			fields[field] = v
 		}
 	}
+	if err := p.applyTypePolicy(fields); err != nil {
+		return err
+	}
 	acc.AddFields(measName, fields, tags)
 	return nil
 }
 
+// applyTypePolicy handles the field values which can't be represented as a
+// metric field, ie, timestamps, arrays or json documents, according to the
+// unsupported_types option: they are dropped, converted to strings or make
+// the row fail.
+func (p *Postgresql) applyTypePolicy(fields map[string]interface{}) error {
+	valid, invalid := internal.ValidateFields(fields)
+	if len(invalid) == 0 {
+		return nil
+	}
+	switch p.UnsupportedTypes {
+	case "error":
+		return fmt.Errorf("field %s", invalid[0])
+	case "string":
+		for name, val := range fields {
+			if _, ok := valid[name]; !ok {
+				fields[name] = formatField(val)
+			}
+		}
+	default:
+		for _, reason := range invalid {
+			p.Log.Debugf("Dropping field %s", reason)
+		}
+		for name := range fields {
+			if _, ok := valid[name]; !ok {
+				delete(fields, name)
+			}
+		}
+	}
+	return nil
+}
+
+// formatField returns the string form of a value of an unsupported type,
+// timestamps are formatted as RFC3339 and other values as json when possible.
+func formatField(val interface{}) string {
+	switch v := val.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	}
+	if b, err := json.Marshal(val); err == nil {
+		return string(b)
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+var validFieldTypes = map[string]bool{
+	"int":    true,
+	"float":  true,
+	"string": true,
+	"bool":   true,
+}
+
+// coerceField converts a column value to the given field type.
+func coerceField(val interface{}, typ string) (interface{}, error) {
+	switch typ {
+	case "int":
+		switch v := val.(type) {
+		case int64:
+			return v, nil
+		case int32:
+			return int64(v), nil
+		case int:
+			return int64(v), nil
+		case float64:
+			return int64(v), nil
+		case float32:
+			return int64(v), nil
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case string:
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err == nil {
+				return i, nil
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse int (%s): %w", v, err)
+			}
+			return int64(f), nil
+		}
+	case "float":
+		switch v := val.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case int32:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse float (%s): %w", v, err)
+			}
+			return f, nil
+		}
+	case "string":
+		return fmt.Sprintf("%v", val), nil
+	case "bool":
+		switch v := val.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			return v != 0, nil
+		case int32:
+			return v != 0, nil
+		case int:
+			return v != 0, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("parse bool (%s): %w", v, err)
+			}
+			return b, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+	return nil, fmt.Errorf("unsupported conversion from %T", val)
+}
+
 func init() {
 	inputs.Add("postgresql_extensible", func() cua.Input {
 		return &Postgresql{
@@ -318,6 +1187,9 @@ func init() {
 				},
 				IsPgBouncer: false,
 			},
+			Cooldown: internal.Duration{
+				Duration: 5 * time.Minute,
+			},
 		}
 	})
 }
@@ -0,0 +1,122 @@
+package postgresqlextensible
+
+import (
+	"strings"
+)
+
+// splitStatements strips the line (--) and block (/* */) comments from a sql
+// script and splits it into its semicolon separated statements. Comment
+// markers and semicolons inside quoted strings, identifiers and dollar quoted
+// bodies are kept as is, as are backslash escaped quotes of E'...' strings.
+// Empty statements are dropped.
+func splitStatements(script string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+	)
+
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" {
+			statements = append(statements, stmt)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+
+		switch {
+		case c == '\'' || c == '"':
+			escapes := c == '\'' && isEscapeStringPrefix(script, i)
+			end := quoteEnd(script, i+1, c, escapes)
+			current.WriteString(script[i:end])
+			i = end - 1
+		case c == '$' && (i == 0 || !isIdentByte(script[i-1])):
+			tag := dollarTag(script[i:])
+			if tag == "" {
+				current.WriteByte(c)
+				continue
+			}
+			end := len(script)
+			if n := strings.Index(script[i+len(tag):], tag); n >= 0 {
+				end = i + len(tag) + n + len(tag)
+			}
+			current.WriteString(script[i:end])
+			i = end - 1
+		case c == '-' && i+1 < len(script) && script[i+1] == '-':
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				// keep the newline so the surrounding tokens stay separated
+				i += end - 1
+			}
+		case c == '/' && i+1 < len(script) && script[i+1] == '*':
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+			current.WriteByte(' ')
+		case c == ';':
+			flush()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+
+	return statements
+}
+
+// quoteEnd returns the index right after the quote closing the string or
+// identifier starting at start, or the length of the script when it is not
+// closed. With escapes a backslash escapes the byte following it.
+func quoteEnd(script string, start int, quote byte, escapes bool) int {
+	for i := start; i < len(script); i++ {
+		switch script[i] {
+		case '\\':
+			if escapes {
+				i++
+			}
+		case quote:
+			return i + 1
+		}
+	}
+	return len(script)
+}
+
+// isEscapeStringPrefix reports whether the quote at i starts an escape
+// string, ie, it follows an E which is not part of a longer identifier.
+func isEscapeStringPrefix(script string, i int) bool {
+	if i == 0 || (script[i-1] != 'E' && script[i-1] != 'e') {
+		return false
+	}
+	return i == 1 || !isIdentByte(script[i-2])
+}
+
+// dollarTag returns the $tag$ (or $$) opening a dollar quoted body at the
+// start of s, or an empty string when s does not start with one, eg, for a
+// positional parameter like $1.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '$':
+			return s[:i+1]
+		case c >= '0' && c <= '9':
+			if i == 1 {
+				return ""
+			}
+		case !isIdentByte(c):
+			return ""
+		}
+	}
+	return ""
+}
+
+// isIdentByte reports whether c may be part of an unquoted identifier.
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
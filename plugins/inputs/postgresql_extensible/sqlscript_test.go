@@ -0,0 +1,143 @@
+package postgresqlextensible
+
+import (
+	"os"
+	"testing"
+
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		expected []string
+	}{
+		{
+			name:     "single",
+			script:   "select 1",
+			expected: []string{"select 1"},
+		},
+		{
+			name:     "trailing semicolon",
+			script:   "select 1;\n",
+			expected: []string{"select 1"},
+		},
+		{
+			name:     "line comments",
+			script:   "-- header\nselect a, -- first\n b from t",
+			expected: []string{"select a, \n b from t"},
+		},
+		{
+			name:     "block comment",
+			script:   "select/* inline */a from t /* unterminated",
+			expected: []string{"select a from t"},
+		},
+		{
+			name:     "quoted markers",
+			script:   "select '--;' as \"a;/*b*/\", 'it''s'; select 2",
+			expected: []string{"select '--;' as \"a;/*b*/\", 'it''s'", "select 2"},
+		},
+		{
+			name:     "dollar quoted body",
+			script:   "create function f() returns int as $$ select 1; -- one\n $$ language sql; select $1",
+			expected: []string{"create function f() returns int as $$ select 1; -- one\n $$ language sql", "select $1"},
+		},
+		{
+			name:     "tagged dollar quoted body",
+			script:   "do $body$ begin perform 1; perform $$;$$; end $body$; select a$b from t",
+			expected: []string{"do $body$ begin perform 1; perform $$;$$; end $body$", "select a$b from t"},
+		},
+		{
+			name:     "escape string",
+			script:   "select E'it\\'s; -- here', e'\\\\'; select 'a\\'; select 2",
+			expected: []string{"select E'it\\'s; -- here', e'\\\\'", "select 'a\\'", "select 2"},
+		},
+		{
+			name:   "only comments",
+			script: "-- nothing here\n/* or here */;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, splitStatements(tt.script))
+		})
+	}
+}
+
+func TestInitCommentedScript(t *testing.T) {
+	p := &Postgresql{
+		Log:   testutil.Logger{},
+		Query: query{{Script: "testdata/commented.sql", Measurement: "db"}},
+	}
+	require.NoError(t, p.Init())
+	require.Len(t, p.Query, 1)
+	require.Equal(t, "SELECT datname, numbackends \nFROM pg_stat_database", p.Query[0].Sqlquery)
+	require.Len(t, p.breakers, 1)
+}
+
+func TestInitMultiStatementScript(t *testing.T) {
+	p := &Postgresql{
+		Log: testutil.Logger{},
+		Query: query{
+			{Sqlquery: "SELECT 1", Measurement: "first"},
+			{Script: "testdata/multi.sql", Measurement: "stats", Version: 901},
+		},
+	}
+	require.NoError(t, p.Init())
+	require.Len(t, p.Query, 3)
+	require.Equal(t, "SELECT 1", p.Query[0].Sqlquery)
+	require.Equal(t, "SELECT * FROM pg_stat_bgwriter", p.Query[1].Sqlquery)
+	require.Equal(t, `SELECT archived_count, 'a;b' AS "odd;name" FROM pg_stat_archiver`, p.Query[2].Sqlquery)
+	for _, q := range p.Query[1:] {
+		require.Equal(t, "stats", q.Measurement)
+		require.Equal(t, 901, q.Version)
+	}
+	require.Len(t, p.breakers, 3)
+	require.Equal(t, []string{"0", "1_0", "1_1"}, []string{p.Query[0].statsID, p.Query[1].statsID, p.Query[2].statsID})
+}
+
+func TestInitScriptKeepsQueryIndex(t *testing.T) {
+	p := &Postgresql{
+		Log: testutil.Logger{},
+		Query: query{
+			{Script: "testdata/multi.sql"},
+			{Script: "testdata/commented.sql"},
+			{Sqlquery: "SELECT 1"},
+		},
+	}
+	require.NoError(t, p.Init())
+	require.Len(t, p.Query, 4)
+	ids := make([]string, 0, len(p.Query))
+	for _, q := range p.Query {
+		ids = append(ids, q.statsID)
+	}
+	require.Equal(t, []string{"0_0", "0_1", "1", "2"}, ids)
+}
+
+func TestReadQueryFromFileBOM(t *testing.T) {
+	query, err := ReadQueryFromFile("testdata/bom.sql")
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM pg_stat_bgwriter\n", query)
+}
+
+func TestInitScriptExpandEnv(t *testing.T) {
+	require.NoError(t, os.Setenv("CUA_TEST_SCHEMA", "metrics"))
+	require.NoError(t, os.Unsetenv("CUA_TEST_UNSET"))
+	defer os.Unsetenv("CUA_TEST_SCHEMA")
+
+	p := &Postgresql{
+		Log: testutil.Logger{},
+		Query: query{
+			{Script: "testdata/env.sql", ExpandEnv: true},
+			{Script: "testdata/env.sql"},
+		},
+	}
+	require.NoError(t, p.Init())
+	require.Len(t, p.Query, 2)
+	require.Equal(t, "SELECT relname, n_live_tup FROM pg_stat_user_tables WHERE schemaname = 'metrics' AND relname <> '$CUA_TEST_UNSET' AND n_live_tup > $1", p.Query[0].Sqlquery)
+	// unexpanded, the "$$" opens a dollar quote which runs to the end of the script
+	require.Equal(t, "SELECT relname, n_live_tup FROM pg_stat_user_tables WHERE schemaname = '${CUA_TEST_SCHEMA}' AND relname <> '$CUA_TEST_UNSET' AND n_live_tup > $$1;", p.Query[1].Sqlquery)
+}
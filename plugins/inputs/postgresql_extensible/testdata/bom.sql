@@ -0,0 +1 @@
+﻿SELECT * FROM pg_stat_bgwriter
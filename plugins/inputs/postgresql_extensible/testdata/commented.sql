@@ -0,0 +1,5 @@
+-- Database statistics, one row per database.
+/* The stats_reset column is ignored by the plugin,
+   selecting it is harmless. */
+SELECT datname, numbackends -- connected backends
+FROM pg_stat_database;
@@ -0,0 +1,2 @@
+-- tables of the ${CUA_TEST_SCHEMA} schema
+SELECT relname, n_live_tup FROM pg_stat_user_tables WHERE schemaname = '${CUA_TEST_SCHEMA}' AND relname <> '$CUA_TEST_UNSET' AND n_live_tup > $$1;
@@ -0,0 +1,5 @@
+-- Background writer statistics
+SELECT * FROM pg_stat_bgwriter;
+
+/* Archiver statistics */
+SELECT archived_count, 'a;b' AS "odd;name" FROM pg_stat_archiver;
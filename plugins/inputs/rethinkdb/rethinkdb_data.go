@@ -1,18 +1,26 @@
 package rethinkdb
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/internal"
+	"gopkg.in/gorethink/gorethink.v3/encoding"
 )
 
 type serverStatus struct {
 	ID      string `gorethink:"id"`
+	Name    string `gorethink:"name"`
 	Network struct {
-		Addresses  []Address `gorethink:"canonical_addresses"`
-		Hostname   string    `gorethink:"hostname"`
-		DriverPort int       `gorethink:"reql_port"`
+		Addresses     []Address `gorethink:"canonical_addresses"`
+		Hostname      string    `gorethink:"hostname"`
+		DriverPort    int       `gorethink:"reql_port"`
+		TimeConnected time.Time `gorethink:"time_connected"`
+		// TimeDisconnected is set once the node stopped reporting
+		TimeDisconnected time.Time `gorethink:"time_disconnected"`
 	} `gorethink:"network"`
 	Process struct {
 		Version      string    `gorethink:"version"`
@@ -38,12 +46,56 @@ type Engine struct {
 	TotalReads    int64 `gorethink:"read_docs_total,omitempty"`
 	WritesPerSec  int64 `gorethink:"written_docs_per_sec,omitempty"`
 	TotalWrites   int64 `gorethink:"written_docs_total,omitempty"`
+
+	// present holds the keys found in the decoded document, it is nil
+	// when the engine stats were not decoded from a document.
+	present map[string]bool
+}
+
+// UnmarshalRQL decodes the query engine stats, recording which keys were
+// present in the document so missing fields can be told apart from zeros.
+func (e *Engine) UnmarshalRQL(data interface{}) error {
+	type engine Engine
+	var decoded engine
+	if err := encoding.Decode(&decoded, data); err != nil {
+		return fmt.Errorf("decode query_engine: %w", err)
+	}
+	*e = Engine(decoded)
+
+	e.present = make(map[string]bool)
+	if doc, ok := data.(map[string]interface{}); ok {
+		for key := range doc {
+			e.present[key] = true
+		}
+	}
+	return nil
 }
 
 type tableStatus struct {
-	ID   string `gorethink:"id"`
-	DB   string `gorethink:"db"`
-	Name string `gorethink:"name"`
+	ID         string `gorethink:"id"`
+	DB         string `gorethink:"db"`
+	Name       string `gorethink:"name"`
+	RaftLeader string `gorethink:"raft_leader"`
+}
+
+type tableConfig struct {
+	ID     string        `gorethink:"id"`
+	Shards []shardConfig `gorethink:"shards"`
+}
+
+type shardConfig struct {
+	Replicas          []string `gorethink:"replicas"`
+	NonvotingReplicas []string `gorethink:"nonvoting_replicas"`
+}
+
+type job struct {
+	Type        string  `gorethink:"type"`
+	DurationSec float64 `gorethink:"duration_sec"`
+}
+
+type issue struct {
+	Type     string `gorethink:"type"`
+	Critical bool   `gorethink:"critical"`
 }
 
 type tableStats struct {
@@ -86,19 +138,76 @@ var engineStats = map[string]string{
 	"total_writes":         "TotalWrites",
 }
 
+// AddEngineStats emits the tracked keys of the engine stats. Keys missing
+// from the decoded document are emitted as 0 when zeroMissing is set and
+// skipped otherwise.
 func (e *Engine) AddEngineStats(
 	keys []string,
+	zeroMissing bool,
 	acc cua.Accumulator,
 	tags map[string]string,
 ) {
 	engine := reflect.ValueOf(e).Elem()
 	fields := make(map[string]interface{})
 	for _, key := range keys {
+		if _, ok := engineStats[key]; !ok {
+			continue
+		}
+		if e.present != nil && !e.present[engineDocKey(engineStats[key])] {
+			if zeroMissing {
+				fields[key] = int64(0)
+			}
+			continue
+		}
 		fields[key] = engine.FieldByName(engineStats[key]).Interface()
 	}
+	if len(fields) == 0 {
+		return
+	}
 	acc.AddFields("rethinkdb_engine", fields, tags)
 }
 
+// engineDocKey returns the document key of the named Engine field.
+func engineDocKey(name string) string {
+	field, ok := reflect.TypeOf(Engine{}).FieldByName(name)
+	if !ok {
+		return ""
+	}
+	return strings.Split(field.Tag.Get("gorethink"), ",")[0]
+}
+
+// AddRaftStats emits the raft leader and the number of voting members of
+// the table, the replicas configured in config which are not non-voting.
+// serverName is the name of the server being gathered and is used to flag
+// whether it is the current leader.
+func (t *tableStatus) AddRaftStats(serverName string, config *tableConfig, acc cua.Accumulator, tags map[string]string) {
+	voters := make(map[string]bool)
+	if config != nil {
+		for _, shard := range config.Shards {
+			nonvoting := make(map[string]bool, len(shard.NonvotingReplicas))
+			for _, server := range shard.NonvotingReplicas {
+				nonvoting[server] = true
+			}
+			for _, server := range shard.Replicas {
+				if !nonvoting[server] {
+					voters[server] = true
+				}
+			}
+		}
+	}
+
+	isLeader := 0
+	if t.RaftLeader != "" && t.RaftLeader == serverName {
+		isLeader = 1
+	}
+
+	fields := map[string]interface{}{
+		"voting_members": int64(len(voters)),
+		"is_leader":      int64(isLeader),
+	}
+	acc.AddFields("rethinkdb_raft", fields, internal.MergeTags(tags, map[string]string{"raft_leader": t.RaftLeader}))
+}
+
 func (s *Storage) AddStats(acc cua.Accumulator, tags map[string]string) {
 	fields := map[string]interface{}{
 		"cache_bytes_in_use":            s.Cache.BytesInUse,
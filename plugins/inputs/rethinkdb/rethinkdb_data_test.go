@@ -33,7 +33,7 @@ func TestAddEngineStats(t *testing.T) {
 		"written_docs_per_sec",
 		"total_writes",
 	}
-	engine.AddEngineStats(keys, &acc, tags)
+	engine.AddEngineStats(keys, false, &acc, tags)
 
 	for _, metric := range keys {
 		assert.True(t, acc.HasInt64Field("rethinkdb_engine", metric))
@@ -64,7 +64,7 @@ func TestAddEngineStatsPartial(t *testing.T) {
 		"total_reads",
 		"total_writes",
 	}
-	engine.AddEngineStats(keys, &acc, tags)
+	engine.AddEngineStats(keys, false, &acc, tags)
 
 	for _, metric := range missingKeys {
 		assert.False(t, acc.HasInt64Field("rethinkdb", metric))
@@ -7,16 +7,53 @@ import (
 	"net/url"
 	"regexp"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/filter"
+	"github.com/circonus-labs/circonus-unified-agent/internal"
 	"gopkg.in/gorethink/gorethink.v3"
 )
 
 type Server struct {
 	URL          *url.URL
-	session      *gorethink.Session
+	session      gorethink.QueryExecutor
 	serverStatus serverStatus
+	collectRaft  bool
+	collectJobs  bool
+	zeroMissing  bool
+	maxDocuments int
+	parseTimeout time.Duration
+	log          cua.Logger
+
+	// engine stats to emit, resolved by RethinkDB.Init
+	clusterMetrics []string
+	memberMetrics  []string
+	tableMetrics   []string
+
+	// tables to gather, every table is gathered when nil
+	dbFilter    filter.Filter
+	tableFilter filter.Filter
+
+	// statusLatency is the time spent querying and reading server_status
+	statusLatency time.Duration
+	// now returns the current time, time.Now when nil
+	now func() time.Time
+
+	// cursorCloser closes the cursors of the queries, (*gorethink.Cursor).Close
+	// when nil
+	cursorCloser func(*gorethink.Cursor) error
+}
+
+// closeCursor closes a cursor of a query, logging the error.
+func (s *Server) closeCursor(cursor *gorethink.Cursor) {
+	closeCursor := s.cursorCloser
+	if closeCursor == nil {
+		closeCursor = (*gorethink.Cursor).Close
+	}
+	if err := closeCursor(cursor); err != nil {
+		s.log.Debugf("Closing cursor: %s", err)
+	}
 }
 
 func (s *Server) gatherData(acc cua.Accumulator) error {
@@ -28,18 +65,32 @@ func (s *Server) gatherData(acc cua.Accumulator) error {
 		return fmt.Errorf("failed version validation: %w", err)
 	}
 
+	s.addServerStatusStats(acc)
+
+	// the collectors are independent, one failing doesn't prevent the
+	// others from emitting their metrics
+	var errs internal.MultiError
 	if err := s.addClusterStats(acc); err != nil {
-		return fmt.Errorf("error adding cluster stats: %w", err)
+		errs = append(errs, fmt.Errorf("error adding cluster stats: %w", err))
 	}
 
 	if err := s.addMemberStats(acc); err != nil {
-		return fmt.Errorf("error adding member stats: %w", err)
+		errs = append(errs, fmt.Errorf("error adding member stats: %w", err))
 	}
 
 	if err := s.addTableStats(acc); err != nil {
-		return fmt.Errorf("error adding table stats: %w", err)
+		errs = append(errs, fmt.Errorf("error adding table stats: %w", err))
+	}
+
+	if s.collectJobs {
+		if err := s.addJobStats(acc); err != nil {
+			errs = append(errs, fmt.Errorf("error adding job stats: %w", err))
+		}
 	}
 
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
@@ -48,20 +99,37 @@ func (s *Server) validateVersion() error {
 		return errors.New("could not determine the RethinkDB server version: process.version key missing")
 	}
 
-	versionRegexp := regexp.MustCompile(`\d.\d.\d`)
-	versionString := versionRegexp.FindString(s.serverStatus.Process.Version)
-	if versionString == "" {
-		return fmt.Errorf("could not determine the RethinkDB server version: malformed version string (%v)", s.serverStatus.Process.Version)
+	major, _, _, err := parseVersion(s.serverStatus.Process.Version)
+	if err != nil {
+		return fmt.Errorf("could not determine the RethinkDB server version: %w", err)
 	}
-
-	majorVersion, err := strconv.Atoi(strings.Split(versionString, "")[0])
-	if err != nil || majorVersion < 2 {
-		return fmt.Errorf("unsupported major version %s", versionString)
+	if major < 2 {
+		return fmt.Errorf("unsupported major version %d (%s)", major, s.serverStatus.Process.Version)
 	}
 	return nil
 }
 
+var versionRegexp = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+
+// parseVersion extracts the major, minor and patch components of the first
+// version found in a process version string, e.g. "rethinkdb 2.4.1~0buster
+// (GCC 8.3.0)". Pre-release and build suffixes are ignored.
+func parseVersion(version string) (major, minor, patch int, err error) {
+	m := versionRegexp.FindStringSubmatch(version)
+	if m == nil {
+		return 0, 0, 0, fmt.Errorf("malformed version string (%v)", version)
+	}
+	components := make([]int, 3)
+	for i := range components {
+		if components[i], err = strconv.Atoi(m[i+1]); err != nil {
+			return 0, 0, 0, fmt.Errorf("malformed version string (%v): %w", version, err)
+		}
+	}
+	return components[0], components[1], components[2], nil
+}
+
 func (s *Server) getServerStatus() error {
+	start := time.Now()
 	cursor, err := gorethink.DB("rethinkdb").Table("server_status").Run(s.session)
 	if err != nil {
 		return fmt.Errorf("server status: %w", err)
@@ -70,12 +138,14 @@ func (s *Server) getServerStatus() error {
 	if cursor.IsNil() {
 		return errors.New("could not determine the RethinkDB server version: no rows returned from the server_status table")
 	}
-	defer cursor.Close()
+	defer s.closeCursor(cursor)
+	// every row is read, max_documents would otherwise leave out the row
+	// of the gathered node on large clusters
 	var serverStatuses []serverStatus
-	err = cursor.All(&serverStatuses)
-	if err != nil {
+	if err := cursor.All(&serverStatuses); err != nil {
 		return errors.New("could not parse server_status results")
 	}
+	s.statusLatency = time.Since(start)
 	host, port, err := net.SplitHostPort(s.URL.Host)
 	if err != nil {
 		return fmt.Errorf("unable to determine provided hostname from %s", s.URL.Host)
@@ -93,6 +163,53 @@ func (s *Server) getServerStatus() error {
 	return fmt.Errorf("unable to determine host id from server_status with %s", s.URL.Host)
 }
 
+// readDocuments calls next, which decodes the next document of the cursor
+// and reports whether there was one, until the cursor is exhausted. At most
+// maxDocuments documents are read within parseTimeout, the remaining ones
+// are ignored and the truncation logged.
+func (s *Server) readDocuments(cursor *gorethink.Cursor, table string, next func() bool) error {
+	start := time.Now()
+	for n := 0; ; n++ {
+		if s.maxDocuments > 0 && n >= s.maxDocuments {
+			var more interface{}
+			if cursor.Next(&more) {
+				s.log.Warnf("Read the first %d documents of %s, ignoring the rest (max_documents)", n, table)
+			}
+			break
+		}
+		if s.parseTimeout > 0 && time.Since(start) > s.parseTimeout {
+			s.log.Warnf("Read %d documents of %s in %s, ignoring the rest (parse_timeout)", n, table, s.parseTimeout)
+			break
+		}
+		if !next() {
+			break
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("%s cursor: %w", table, err)
+	}
+	return nil
+}
+
+// addServerStatusStats emits the round trip time of the server_status query
+// and how long ago the node last reported to the cluster, zero while it is
+// connected, a lagging node is likely to be partitioned.
+func (s *Server) addServerStatusStats(acc cua.Accumulator) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	lastSeen := 0.0
+	if t := s.serverStatus.Network.TimeDisconnected; !t.IsZero() {
+		lastSeen = now().Sub(t).Seconds()
+	}
+	fields := map[string]interface{}{
+		"latency_ms":        float64(s.statusLatency) / float64(time.Millisecond),
+		"last_seen_seconds": lastSeen,
+	}
+	acc.AddFields("rethinkdb_server_status", fields, s.getDefaultTags())
+}
+
 func (s *Server) getDefaultTags() map[string]string {
 	tags := make(map[string]string)
 	tags["rethinkdb_host"] = s.URL.Host
@@ -113,15 +230,14 @@ func (s *Server) addClusterStats(acc cua.Accumulator) error {
 	if err != nil {
 		return fmt.Errorf("cluster stats query error: %w", err)
 	}
-	defer cursor.Close()
+	defer s.closeCursor(cursor)
 	var clusterStats stats
 	if err := cursor.One(&clusterStats); err != nil {
 		return fmt.Errorf("failure to parse cluster stats: %w", err)
 	}
 
-	tags := s.getDefaultTags()
-	tags["type"] = "cluster"
-	clusterStats.Engine.AddEngineStats(ClusterTracking, acc, tags)
+	tags := internal.MergeTags(s.getDefaultTags(), map[string]string{"type": "cluster"})
+	clusterStats.Engine.AddEngineStats(s.clusterMetrics, s.zeroMissing, acc, tags)
 	return nil
 }
 
@@ -141,15 +257,19 @@ func (s *Server) addMemberStats(acc cua.Accumulator) error {
 	if err != nil {
 		return fmt.Errorf("member stats query error: %w", err)
 	}
-	defer cursor.Close()
+	defer s.closeCursor(cursor)
 	var memberStats stats
 	if err := cursor.One(&memberStats); err != nil {
+		if errors.Is(err, gorethink.ErrEmptyResult) {
+			// a node which just joined the cluster has no stats yet
+			s.log.Debugf("No member stats for server %s yet", s.serverStatus.ID)
+			return nil
+		}
 		return fmt.Errorf("failure to parse member stats: %w", err)
 	}
 
-	tags := s.getDefaultTags()
-	tags["type"] = "member"
-	memberStats.Engine.AddEngineStats(MemberTracking, acc, tags)
+	tags := internal.MergeTags(s.getDefaultTags(), map[string]string{"type": "member"})
+	memberStats.Engine.AddEngineStats(s.memberMetrics, s.zeroMissing, acc, tags)
 	return nil
 }
 
@@ -166,30 +286,144 @@ func (s *Server) addTableStats(acc cua.Accumulator) error {
 		return fmt.Errorf("table stats query error: %w", err)
 	}
 
-	defer tablesCursor.Close()
+	defer s.closeCursor(tablesCursor)
 	var tables []tableStatus
-	err = tablesCursor.All(&tables)
+	err = s.readDocuments(tablesCursor, "table_status", func() bool {
+		var table tableStatus
+		if !tablesCursor.Next(&table) {
+			return false
+		}
+		tables = append(tables, table)
+		return true
+	})
 	if err != nil {
 		return errors.New("could not parse table_status results")
 	}
-	for _, table := range tables {
-		cursor, err := gorethink.DB("rethinkdb").Table("stats").
-			Get([]string{"table_server", table.ID, s.serverStatus.ID}).
-			Run(s.session)
-		if err != nil {
-			return fmt.Errorf("table stats query error: %w", err)
+	var configs map[string]*tableConfig
+	if s.collectRaft {
+		if configs, err = s.getTableConfigs(); err != nil {
+			return err
 		}
-		defer cursor.Close()
-		var ts tableStats
-		if err := cursor.One(&ts); err != nil {
-			return fmt.Errorf("failure to parse table stats: %w", err)
+	}
+
+	for i := range tables {
+		if !s.tableSelected(&tables[i]) {
+			continue
 		}
+		if err := s.addTableStat(acc, &tables[i], configs[tables[i].ID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getTableConfigs returns the configuration of the tables by id, which the
+// voting members of the tables are known from.
+func (s *Server) getTableConfigs() (map[string]*tableConfig, error) {
+	cursor, err := gorethink.DB("rethinkdb").Table("table_config").Run(s.session)
+	if err != nil {
+		return nil, fmt.Errorf("table config query error: %w", err)
+	}
+	defer s.closeCursor(cursor)
+	var configs []tableConfig
+	if err := cursor.All(&configs); err != nil {
+		return nil, fmt.Errorf("failure to parse table config: %w", err)
+	}
+
+	byID := make(map[string]*tableConfig, len(configs))
+	for i := range configs {
+		byID[configs[i].ID] = &configs[i]
+	}
+	return byID, nil
+}
+
+// tableSelected reports whether the stats of the table are gathered.
+func (s *Server) tableSelected(table *tableStatus) bool {
+	if s.dbFilter != nil && !s.dbFilter.Match(table.DB) {
+		return false
+	}
+	if s.tableFilter != nil {
+		return s.tableFilter.Match(table.Name) || s.tableFilter.Match(table.DB+"."+table.Name)
+	}
+	return true
+}
 
-		tags := s.getDefaultTags()
-		tags["type"] = "data"
-		tags["ns"] = fmt.Sprintf("%s.%s", table.DB, table.Name)
-		ts.Engine.AddEngineStats(TableTracking, acc, tags)
-		ts.Storage.AddStats(acc, tags)
+// addTableStat emits the stats of a single table. The stats cursor is closed
+// before returning so large clusters do not keep a cursor open per table.
+func (s *Server) addTableStat(acc cua.Accumulator, table *tableStatus, config *tableConfig) error {
+	cursor, err := gorethink.DB("rethinkdb").Table("stats").
+		Get([]string{"table_server", table.ID, s.serverStatus.ID}).Run(s.session)
+	if err != nil {
+		return fmt.Errorf("table stats query error: %w", err)
+	}
+	defer s.closeCursor(cursor)
+	var ts tableStats
+	if err := cursor.One(&ts); err != nil {
+		return fmt.Errorf("failure to parse table stats: %w", err)
 	}
+
+	tags := internal.MergeTags(s.getDefaultTags(), map[string]string{
+		"type": "data",
+		"ns":   fmt.Sprintf("%s.%s", table.DB, table.Name),
+	})
+	ts.Engine.AddEngineStats(s.tableMetrics, s.zeroMissing, acc, tags)
+	ts.Storage.AddStats(acc, tags)
+
+	if s.collectRaft {
+		table.AddRaftStats(s.serverStatus.Name, config, acc, tags)
+	}
+	return nil
+}
+
+func (s *Server) addJobStats(acc cua.Accumulator) error {
+	cursor, err := gorethink.DB("rethinkdb").Table("jobs").Run(s.session)
+	if err != nil {
+		return fmt.Errorf("jobs query error: %w", err)
+	}
+	defer s.closeCursor(cursor)
+	var jobs []job
+	if err := cursor.All(&jobs); err != nil {
+		return fmt.Errorf("failure to parse jobs: %w", err)
+	}
+
+	issueCursor, err := gorethink.DB("rethinkdb").Table("current_issues").Run(s.session)
+	if err != nil {
+		return fmt.Errorf("current issues query error: %w", err)
+	}
+	defer s.closeCursor(issueCursor)
+	var issues []issue
+	if err := issueCursor.All(&issues); err != nil {
+		return fmt.Errorf("failure to parse current issues: %w", err)
+	}
+
+	var oldestBackfill float64
+	var backfills int64
+	for _, j := range jobs {
+		if j.Type != "backfill" {
+			continue
+		}
+		backfills++
+		if j.DurationSec > oldestBackfill {
+			oldestBackfill = j.DurationSec
+		}
+	}
+
+	var critical int64
+	for _, i := range issues {
+		if i.Critical {
+			critical++
+		}
+	}
+
+	tags := internal.MergeTags(s.getDefaultTags(), map[string]string{"type": "cluster"})
+	acc.AddFields("rethinkdb_jobs", map[string]interface{}{
+		"oldest_backfill_seconds": oldestBackfill,
+	}, tags)
+	acc.AddFields("rethinkdb_cluster", map[string]interface{}{
+		"jobs":            int64(len(jobs)),
+		"backfill_jobs":   backfills,
+		"issues":          int64(len(issues)),
+		"critical_issues": critical,
+	}, tags)
 	return nil
 }
@@ -0,0 +1,127 @@
+package rethinkdb
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tlsint "github.com/circonus-labs/circonus-unified-agent/plugins/common/tls"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var pki = testutil.NewPKI("../../../testutil/pki")
+
+func writeKeyPair(t *testing.T, dir, cert, key string, mod time.Time) (string, string) {
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, []byte(cert), 0600))
+	require.NoError(t, os.WriteFile(keyFile, []byte(key), 0600))
+	require.NoError(t, os.Chtimes(certFile, mod, mod))
+	require.NoError(t, os.Chtimes(keyFile, mod, mod))
+	return certFile, keyFile
+}
+
+func TestCertReloaderRotation(t *testing.T) {
+	dir := t.TempDir()
+	mod := time.Now().Add(-time.Hour)
+	certFile, keyFile := writeKeyPair(t, dir, pki.ReadClientCert(), pki.ReadClientKey(), mod)
+
+	r, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	first, err := r.GetClientCertificate(nil)
+	require.NoError(t, err)
+
+	// unchanged files return the cached certificate
+	again, err := r.GetClientCertificate(nil)
+	require.NoError(t, err)
+	require.Same(t, first, again)
+
+	// rotate to a different key pair
+	writeKeyPair(t, dir, pki.ReadServerCert(), pki.ReadServerKey(), mod.Add(time.Minute))
+
+	rotated, err := r.GetClientCertificate(nil)
+	require.NoError(t, err)
+	require.NotEqual(t, first.Certificate[0], rotated.Certificate[0])
+}
+
+func TestCertReloaderKeepsCertDuringPartialRotation(t *testing.T) {
+	dir := t.TempDir()
+	mod := time.Now().Add(-time.Hour)
+	certFile, keyFile := writeKeyPair(t, dir, pki.ReadClientCert(), pki.ReadClientKey(), mod)
+
+	r, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	first, err := r.GetClientCertificate(nil)
+	require.NoError(t, err)
+
+	// only the certificate has been replaced so far, the pair does not match
+	writeKeyPair(t, dir, pki.ReadServerCert(), pki.ReadClientKey(), mod.Add(time.Minute))
+
+	current, err := r.GetClientCertificate(nil)
+	require.NoError(t, err)
+	require.Same(t, first, current)
+}
+
+func TestInitTLSUsesCertReloader(t *testing.T) {
+	r := &RethinkDB{
+		ClientConfig: tlsint.ClientConfig{
+			TLSCA:   pki.CACertPath(),
+			TLSCert: pki.ClientCertPath(),
+			TLSKey:  pki.ClientKeyPath(),
+		},
+	}
+	require.NoError(t, r.Init())
+	require.NotNil(t, r.tlsConfig)
+	require.NotNil(t, r.tlsConfig.RootCAs)
+	require.Empty(t, r.tlsConfig.Certificates)
+	require.NotNil(t, r.tlsConfig.GetClientCertificate)
+
+	cert, err := r.tlsConfig.GetClientCertificate(nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, cert.Certificate)
+}
+
+func TestInitWithoutTLS(t *testing.T) {
+	r := &RethinkDB{}
+	require.NoError(t, r.Init())
+	require.Nil(t, r.tlsConfig)
+}
+
+func TestConnectOptsSSLAliases(t *testing.T) {
+	r := &RethinkDB{
+		SSLCA:   pki.CACertPath(),
+		SSLCert: pki.ClientCertPath(),
+		SSLKey:  pki.ClientKeyPath(),
+		ClientConfig: tlsint.ClientConfig{
+			InsecureSkipVerify: true,
+		},
+	}
+	require.NoError(t, r.Init())
+
+	opts := r.connectOpts(&url.URL{Scheme: "rethinkdb2", Host: "db.example.com:28015", User: url.UserPassword("admin", "secret")})
+	require.Equal(t, "db.example.com:28015", opts.Address)
+	require.Equal(t, "admin", opts.Username)
+	require.Equal(t, "secret", opts.Password)
+	require.NotNil(t, opts.TLSConfig)
+	require.NotNil(t, opts.TLSConfig.RootCAs)
+	require.NotNil(t, opts.TLSConfig.GetClientCertificate)
+	require.True(t, opts.TLSConfig.InsecureSkipVerify)
+}
+
+func TestConnectOptsTLSOptionsWin(t *testing.T) {
+	r := &RethinkDB{
+		SSLCA: "/does/not/exist.pem",
+		ClientConfig: tlsint.ClientConfig{
+			TLSCA: pki.CACertPath(),
+		},
+	}
+	require.NoError(t, r.Init())
+
+	opts := r.connectOpts(&url.URL{Host: "127.0.0.1:28015"})
+	require.NotNil(t, opts.TLSConfig)
+	require.NotNil(t, opts.TLSConfig.RootCAs)
+}